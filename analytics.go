@@ -0,0 +1,263 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SummaryPeriod is the period of the invoice summaries.
+type SummaryPeriod int
+
+// The periods of the invoice summaries.
+const (
+	// SummaryPeriodDay groups the invoices by calendar day.
+	SummaryPeriodDay SummaryPeriod = iota
+
+	// SummaryPeriodWeek groups the invoices by week, starting on Monday.
+	SummaryPeriodWeek
+)
+
+// InvoiceSummaryOpts specifies the optional parameters to the
+// InvoiceService.Summarize method.
+type InvoiceSummaryOpts struct {
+	// Period groups the invoices by day or week. Defaults to SummaryPeriodDay.
+	Period SummaryPeriod
+
+	// Location is the time zone of the day and week boundaries. Defaults to UTC.
+	Location *time.Location
+}
+
+// DurationPercentiles are the percentiles of a set of durations,
+// calculated with the nearest-rank method.
+type DurationPercentiles struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// InvoiceSummary is the statistics of the invoices created in a period.
+type InvoiceSummary struct {
+	// Start and End are the bounds of the period, End is exclusive.
+	Start time.Time
+	End   time.Time
+
+	// Total is the number of the created invoices.
+	Total int
+
+	// Statuses is the number of invoices in each current status.
+	Statuses map[InvoiceStatus]int
+
+	// InvoiceVolume is the paid invoice amount per invoice asset code.
+	InvoiceVolume map[string]string
+
+	// PaymentVolume is the paid payment amount per payment asset code.
+	PaymentVolume map[string]string
+
+	// ConversionRate is the share of the paid invoices, from 0 to 1.
+	ConversionRate float64
+
+	// TimeoutRate is the share of the timed out invoices, from 0 to 1.
+	TimeoutRate float64
+
+	// TimeToPay is the time from the creation to the completion of the paid invoices.
+	TimeToPay DurationPercentiles
+}
+
+// InvoiceReport is the invoice statistics over a time range.
+type InvoiceReport struct {
+	// Periods are the summaries of every day or week of the range in order,
+	// including the periods without invoices.
+	Periods []*InvoiceSummary
+
+	// Total is the summary of the whole range.
+	Total *InvoiceSummary
+}
+
+// Summarize builds the statistics of the invoices created from the from time
+// up to, but not including, the to time. The invoices are grouped by
+// their creation time, and the statuses are the ones at the time of the call.
+func (s *InvoiceService) Summarize(ctx context.Context, from, to time.Time, opts *InvoiceSummaryOpts) (*InvoiceReport, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from time must be before to time")
+	}
+
+	o := InvoiceSummaryOpts{Location: time.UTC}
+	if opts != nil {
+		o.Period = opts.Period
+		if opts.Location != nil {
+			o.Location = opts.Location
+		}
+	}
+
+	total := newSummaryBuilder(from, to)
+	var periods []*summaryBuilder
+	for start := periodStart(from, o); start.Before(to); start = periodEnd(start, o) {
+		periods = append(periods, newSummaryBuilder(start, periodEnd(start, o)))
+	}
+
+	list := &InvoiceListOpts{
+		Take:        invoiceListPageSize,
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+	}
+	for {
+		invoices, _, err := s.List(ctx, list)
+		if err != nil {
+			return nil, err
+		}
+		for _, invoice := range invoices {
+			createdAt, err := parseTime(invoice.CreatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("invoice %s: %w", invoice.ID, err)
+			}
+			if createdAt.Before(from) || !createdAt.Before(to) {
+				continue
+			}
+			i := sort.Search(len(periods), func(i int) bool { return periods[i].End.After(createdAt) })
+			periods[i].add(invoice, createdAt)
+			total.add(invoice, createdAt)
+		}
+		if len(invoices) < invoiceListPageSize {
+			break
+		}
+		list.Skip += invoiceListPageSize
+	}
+
+	report := &InvoiceReport{Total: total.build()}
+	for _, p := range periods {
+		report.Periods = append(report.Periods, p.build())
+	}
+
+	return report, nil
+}
+
+// periodStart returns the start of the period that contains t.
+func periodStart(t time.Time, o InvoiceSummaryOpts) time.Time {
+	t = t.In(o.Location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, o.Location)
+	if o.Period == SummaryPeriodWeek {
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+
+	return day
+}
+
+// periodEnd returns the start of the period that follows the one starting at start.
+func periodEnd(start time.Time, o InvoiceSummaryOpts) time.Time {
+	if o.Period == SummaryPeriodWeek {
+		return start.AddDate(0, 0, 7)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
+
+// summaryBuilder accumulates the statistics of an InvoiceSummary.
+type summaryBuilder struct {
+	*InvoiceSummary
+	invoiceVolume *volume
+	paymentVolume *volume
+	timeToPay     []time.Duration
+}
+
+func newSummaryBuilder(start, end time.Time) *summaryBuilder {
+	return &summaryBuilder{
+		InvoiceSummary: &InvoiceSummary{
+			Start:    start,
+			End:      end,
+			Statuses: make(map[InvoiceStatus]int),
+		},
+		invoiceVolume: newVolume(),
+		paymentVolume: newVolume(),
+	}
+}
+
+func (b *summaryBuilder) add(invoice *Invoice, createdAt time.Time) {
+	b.Total++
+	b.Statuses[invoice.Status]++
+	if !invoice.Status.IsSuccessful() {
+		return
+	}
+
+	b.invoiceVolume.add(invoice.InvoiceAssetCode, invoice.InvoiceAmount)
+	b.paymentVolume.add(invoice.PaymentAssetCode, invoice.PaymentAmount)
+	if completedAt, err := parseTime(invoice.CompletedAt); err == nil && !completedAt.Before(createdAt) {
+		b.timeToPay = append(b.timeToPay, completedAt.Sub(createdAt))
+	}
+}
+
+func (b *summaryBuilder) build() *InvoiceSummary {
+	if b.Total > 0 {
+		b.ConversionRate = float64(b.Statuses[InvoiceStatusPaid]) / float64(b.Total)
+		b.TimeoutRate = float64(b.Statuses[InvoiceStatusTimeout]) / float64(b.Total)
+	}
+	b.InvoiceVolume = b.invoiceVolume.amounts()
+	b.PaymentVolume = b.paymentVolume.amounts()
+	b.TimeToPay = percentiles(b.timeToPay)
+
+	return b.InvoiceSummary
+}
+
+// volume sums the decimal amounts per asset code without losing precision.
+type volume struct {
+	sums   map[string]*big.Rat
+	places map[string]int
+}
+
+func newVolume() *volume {
+	return &volume{sums: make(map[string]*big.Rat), places: make(map[string]int)}
+}
+
+func (v *volume) add(asset, amount string) {
+	x, ok := new(big.Rat).SetString(amount)
+	if asset == "" || !ok {
+		return
+	}
+	if v.sums[asset] == nil {
+		v.sums[asset] = new(big.Rat)
+	}
+	v.sums[asset].Add(v.sums[asset], x)
+	if _, frac, ok := strings.Cut(amount, "."); ok && len(frac) > v.places[asset] {
+		v.places[asset] = len(frac)
+	}
+}
+
+func (v *volume) amounts() map[string]string {
+	amounts := make(map[string]string, len(v.sums))
+	for asset, sum := range v.sums {
+		amounts[asset] = sum.FloatString(v.places[asset])
+	}
+
+	return amounts
+}
+
+// percentiles returns the percentiles of the durations, which it sorts.
+func percentiles(durations []time.Duration) DurationPercentiles {
+	n := len(durations)
+	if n == 0 {
+		return DurationPercentiles{}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	rank := func(p int) time.Duration {
+		// The smallest value that is greater than or equal to p percent of the values.
+		i := (p*n + 99) / 100
+		if i < 1 {
+			i = 1
+		}
+		return durations[i-1]
+	}
+
+	return DurationPercentiles{
+		Count: n,
+		P50:   rank(50),
+		P90:   rank(90),
+		P99:   rank(99),
+		Max:   durations[n-1],
+	}
+}
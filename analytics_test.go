@@ -0,0 +1,127 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvoiceService_Summarize(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	invoices := []string{
+		`{"id":"1","status":"PAID","invoiceAmount":"100.5","invoiceAssetCode":"USDT","paymentAmount":"0.001","paymentAssetCode":"BTC","createdAt":"2023-07-03T10:00:00.000Z","completedAt":"2023-07-03T10:05:00.000Z"}`,
+		`{"id":"2","status":"PAID","invoiceAmount":"20.25","invoiceAssetCode":"USDT","paymentAmount":"20.25","paymentAssetCode":"USDT","createdAt":"2023-07-03T12:00:00.000Z","completedAt":"2023-07-03T12:01:00.000Z"}`,
+		`{"id":"3","status":"TIMEOUT","invoiceAmount":"5","invoiceAssetCode":"USDT","createdAt":"2023-07-03T23:59:59.000Z"}`,
+		`{"id":"4","status":"PAYMENT_AWAITING","invoiceAmount":"7","invoiceAssetCode":"UAH","createdAt":"2023-07-05T08:00:00.000Z"}`,
+		`{"id":"5","status":"PAID","invoiceAmount":"300","invoiceAssetCode":"UAH","paymentAmount":"8","paymentAssetCode":"USDT","createdAt":"2023-07-10T08:00:00.000Z","completedAt":"2023-07-10T09:00:00.000Z"}`,
+	}
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		testURL(t, r, "/v1/invoice?createdFrom=2023-07-03T00%3A00%3A00Z&createdTo=2023-07-12T00%3A00%3A00Z&take=100")
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(invoices, ","))
+	})
+
+	from := time.Date(2023, 7, 3, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 7, 12, 0, 0, 0, 0, time.UTC)
+
+	report, err := client.Invoice.Summarize(context.Background(), from, to, &InvoiceSummaryOpts{Period: SummaryPeriodWeek})
+	if err != nil {
+		t.Fatalf("Invoice.Summarize returned error: %v", err)
+	}
+
+	if len(report.Periods) != 2 {
+		t.Fatalf("Invoice.Summarize returned %d periods, want 2", len(report.Periods))
+	}
+	week := report.Periods[0]
+	if !week.Start.Equal(from) || !week.End.Equal(from.AddDate(0, 0, 7)) {
+		t.Errorf("Invoice.Summarize first week is %v - %v", week.Start, week.End)
+	}
+	want := &InvoiceSummary{
+		Start:          week.Start,
+		End:            week.End,
+		Total:          4,
+		Statuses:       map[InvoiceStatus]int{InvoiceStatusPaid: 2, InvoiceStatusTimeout: 1, InvoiceStatusPaymentAwaiting: 1},
+		InvoiceVolume:  map[string]string{"USDT": "120.75"},
+		PaymentVolume:  map[string]string{"BTC": "0.001", "USDT": "20.25"},
+		ConversionRate: 0.5,
+		TimeoutRate:    0.25,
+		TimeToPay:      DurationPercentiles{Count: 2, P50: time.Minute, P90: 5 * time.Minute, P99: 5 * time.Minute, Max: 5 * time.Minute},
+	}
+	if !reflect.DeepEqual(week, want) {
+		t.Errorf("Invoice.Summarize returned %+v, want %+v", week, want)
+	}
+
+	total := report.Total
+	if total.Total != 5 || total.Statuses[InvoiceStatusPaid] != 3 || total.ConversionRate != 0.6 {
+		t.Errorf("Invoice.Summarize returned total %+v", total)
+	}
+	if got, want := total.InvoiceVolume, map[string]string{"USDT": "120.75", "UAH": "300"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invoice.Summarize returned total invoice volume %v, want %v", got, want)
+	}
+
+	daily, err := client.Invoice.Summarize(context.Background(), from, to, nil)
+	if err != nil {
+		t.Fatalf("Invoice.Summarize returned error: %v", err)
+	}
+	var totals []int
+	for _, day := range daily.Periods {
+		totals = append(totals, day.Total)
+	}
+	if want := []int{3, 0, 1, 0, 0, 0, 0, 1, 0}; !reflect.DeepEqual(totals, want) {
+		t.Errorf("Invoice.Summarize returned daily totals %v, want %v", totals, want)
+	}
+}
+
+func TestInvoiceService_SummarizeInvalidRange(t *testing.T) {
+	client, _, teardown := setupClient()
+	defer teardown()
+
+	now := time.Now()
+	if _, err := client.Invoice.Summarize(context.Background(), now, now, nil); err == nil {
+		t.Errorf("Invoice.Summarize with empty range returned nil, want error")
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	kyiv := time.FixedZone("EEST", 3*60*60)
+	tests := []struct {
+		title string
+		t     time.Time
+		opts  InvoiceSummaryOpts
+		want  time.Time
+	}{
+		{"day", time.Date(2023, 7, 5, 15, 0, 0, 0, time.UTC), InvoiceSummaryOpts{Location: time.UTC}, time.Date(2023, 7, 5, 0, 0, 0, 0, time.UTC)},
+		{"day in location", time.Date(2023, 7, 5, 22, 0, 0, 0, time.UTC), InvoiceSummaryOpts{Location: kyiv}, time.Date(2023, 7, 6, 0, 0, 0, 0, kyiv)},
+		{"week", time.Date(2023, 7, 5, 15, 0, 0, 0, time.UTC), InvoiceSummaryOpts{Period: SummaryPeriodWeek, Location: time.UTC}, time.Date(2023, 7, 3, 0, 0, 0, 0, time.UTC)},
+		{"week on sunday", time.Date(2023, 7, 9, 15, 0, 0, 0, time.UTC), InvoiceSummaryOpts{Period: SummaryPeriodWeek, Location: time.UTC}, time.Date(2023, 7, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			if got := periodStart(test.t, test.opts); !got.Equal(test.want) {
+				t.Errorf("periodStart returned %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+
+	want := DurationPercentiles{Count: 100, P50: 50 * time.Second, P90: 90 * time.Second, P99: 99 * time.Second, Max: 100 * time.Second}
+	if got := percentiles(durations); got != want {
+		t.Errorf("percentiles returned %+v, want %+v", got, want)
+	}
+	if got := percentiles(nil); got != (DurationPercentiles{}) {
+		t.Errorf("percentiles of nil returned %+v, want zero", got)
+	}
+}
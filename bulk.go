@@ -0,0 +1,393 @@
+package kunapay
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// invoiceRequestColumns are the CSV columns of a CreateInvoiceRequest,
+// named after its JSON fields.
+var invoiceRequestColumns = map[string]func(r *CreateInvoiceRequest, v string){
+	"amount":             func(r *CreateInvoiceRequest, v string) { r.Amount = v },
+	"asset":              func(r *CreateInvoiceRequest, v string) { r.Asset = v },
+	"externalOrderId":    func(r *CreateInvoiceRequest, v string) { r.ExternalOrderID = v },
+	"productDescription": func(r *CreateInvoiceRequest, v string) { r.ProductDescription = v },
+	"productCategory":    func(r *CreateInvoiceRequest, v string) { r.ProductCategory = v },
+	"callbackUrl":        func(r *CreateInvoiceRequest, v string) { r.CallbackURL = v },
+}
+
+// ReadInvoiceRequestsCSV reads the invoice requests from CSV. The first record
+// is the header with the JSON field names of CreateInvoiceRequest,
+// e.g. "amount,asset,externalOrderId".
+func ReadInvoiceRequestsCSV(r io.Reader) ([]*CreateInvoiceRequest, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	for _, column := range header {
+		if _, ok := invoiceRequestColumns[column]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+	}
+
+	var requests []*CreateInvoiceRequest
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return requests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		request := &CreateInvoiceRequest{}
+		for i, column := range header {
+			invoiceRequestColumns[column](request, strings.TrimSpace(record[i]))
+		}
+		requests = append(requests, request)
+	}
+}
+
+// ReadInvoiceRequestsJSONL reads the invoice requests from JSON Lines,
+// one CreateInvoiceRequest object per line. Blank lines are skipped.
+func ReadInvoiceRequestsJSONL(r io.Reader) ([]*CreateInvoiceRequest, error) {
+	var requests []*CreateInvoiceRequest
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(scanner.Text()))
+		dec.DisallowUnknownFields()
+
+		request := &CreateInvoiceRequest{}
+		if err := dec.Decode(request); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// BulkInvoiceResult is the result of creating the invoice of a single row.
+type BulkInvoiceResult struct {
+	// Row is the 1-based number of the request.
+	Row             int
+	ExternalOrderID string
+	ID              string
+	PaymentLink     string
+
+	// Created reports whether the invoice was created by this run,
+	// rather than reused from the API or from the previous results.
+	Created bool
+
+	Err error
+}
+
+// RowError reports an invalid bulk request row.
+type RowError struct {
+	Row int
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// BulkValidationError reports all invalid rows of a bulk request.
+// No invoice is created if any row is invalid.
+type BulkValidationError struct {
+	Errors []*RowError
+}
+
+// Error returns the string representation of the error.
+func (e *BulkValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d invalid rows: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// BulkCreatorOpts specifies the optional parameters to the BulkCreator.
+type BulkCreatorOpts struct {
+	// Workers is the number of invoices created concurrently. Defaults to 4.
+	// The requests are also subject to the client rate limiter, see WithRateLimiter.
+	Workers int
+
+	// Currencies, as returned by InvoiceService.GetCurrencies, enable
+	// the asset and precision checks of the rows.
+	Currencies []*InvoiceCurrency
+
+	// Previous are the results of an interrupted run. Successful rows are
+	// matched by the external order ID and are not sent to the API again.
+	Previous []*BulkInvoiceResult
+
+	// OnResult is called with every result as soon as it is known,
+	// e.g. to write it with a BulkResultWriter. If it returns an error,
+	// the remaining rows are not created.
+	OnResult func(result *BulkInvoiceResult) error
+}
+
+// BulkCreator creates many invoices with bounded concurrency.
+//
+// Every row must have a unique external order ID. The invoices are created
+// with InvoiceService.GetOrCreate, so an interrupted run can be repeated safely:
+// the invoices created before the interruption are reused, not duplicated.
+type BulkCreator struct {
+	client *Client
+	opts   BulkCreatorOpts
+}
+
+// NewBulkCreator returns a new BulkCreator.
+func NewBulkCreator(client *Client, opts *BulkCreatorOpts) *BulkCreator {
+	o := BulkCreatorOpts{Workers: 4}
+	if opts != nil {
+		if opts.Workers > 0 {
+			o.Workers = opts.Workers
+		}
+		o.Currencies = opts.Currencies
+		o.Previous = opts.Previous
+		o.OnResult = opts.OnResult
+	}
+
+	return &BulkCreator{client: client, opts: o}
+}
+
+// Validate checks all rows and returns *BulkValidationError with every invalid row.
+func (b *BulkCreator) Validate(requests []*CreateInvoiceRequest) error {
+	var errs []*RowError
+	rows := make(map[string]int, len(requests))
+	for i, request := range requests {
+		row := i + 1
+		if strings.TrimSpace(request.ExternalOrderID) == "" {
+			errs = append(errs, &RowError{Row: row, Err: fmt.Errorf("external order ID is required")})
+		} else if prev, ok := rows[request.ExternalOrderID]; ok {
+			errs = append(errs, &RowError{Row: row, Err: fmt.Errorf("external order ID %q is already used in row %d", request.ExternalOrderID, prev)})
+		} else {
+			rows[request.ExternalOrderID] = row
+		}
+		if err := request.Validate(b.opts.Currencies); err != nil {
+			errs = append(errs, &RowError{Row: row, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return &BulkValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Create validates all rows first and then creates the invoices.
+// It returns the results in the order of the requests. The error of a single
+// row is reported in its result; the returned error is only set if the rows
+// are invalid, the OnResult callback fails or the context is done.
+func (b *BulkCreator) Create(ctx context.Context, requests []*CreateInvoiceRequest) ([]*BulkInvoiceResult, error) {
+	if err := b.Validate(requests); err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]*BulkInvoiceResult, len(b.opts.Previous))
+	for _, result := range b.opts.Previous {
+		if result.Err == nil && result.ID != "" {
+			previous[result.ExternalOrderID] = result
+		}
+	}
+
+	results := make([]*BulkInvoiceResult, len(requests))
+	for i, request := range requests {
+		if prev, ok := previous[request.ExternalOrderID]; ok {
+			results[i] = &BulkInvoiceResult{
+				Row:             i + 1,
+				ExternalOrderID: request.ExternalOrderID,
+				ID:              prev.ID,
+				PaymentLink:     prev.PaymentLink,
+			}
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		failed bool
+	)
+	report := func(result *BulkInvoiceResult) error {
+		if b.opts.OnResult == nil {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if failed {
+			return nil
+		}
+		if err := b.opts.OnResult(result); err != nil {
+			failed = true
+			return err
+		}
+		return nil
+	}
+
+	// The row errors are kept in the results, so only a failed OnResult
+	// stops the other rows.
+	err := forEach(ctx, len(requests), b.opts.Workers, func(ctx context.Context, i int) error {
+		if results[i] == nil {
+			results[i] = b.create(ctx, i+1, requests[i])
+		}
+		return report(results[i])
+	})
+
+	// The rows left after the stop are reported as canceled.
+	canceled := ctx.Err()
+	if canceled == nil {
+		canceled = context.Canceled
+	}
+	for i, result := range results {
+		if result == nil {
+			results[i] = &BulkInvoiceResult{Row: i + 1, ExternalOrderID: requests[i].ExternalOrderID, Err: canceled}
+		}
+	}
+
+	return results, err
+}
+
+// create creates the invoice of a single row.
+func (b *BulkCreator) create(ctx context.Context, row int, request *CreateInvoiceRequest) *BulkInvoiceResult {
+	result := &BulkInvoiceResult{Row: row, ExternalOrderID: request.ExternalOrderID}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	invoice, _, err := b.client.Invoice.GetOrCreate(ctx, request)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.ID = invoice.ID
+	result.PaymentLink = invoice.PaymentLink
+	result.Created = invoice.Created
+
+	return result
+}
+
+// bulkResultHeader is the CSV header of the bulk results.
+var bulkResultHeader = []string{"row", "externalOrderId", "id", "paymentLink", "created", "error"}
+
+// BulkResultWriter writes the bulk results as CSV. It is safe for concurrent use.
+type BulkResultWriter struct {
+	mu          sync.Mutex
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// NewBulkResultWriter returns a new BulkResultWriter that writes to w.
+func NewBulkResultWriter(w io.Writer) *BulkResultWriter {
+	return &BulkResultWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes the result and flushes it, so the results written before
+// an interruption are not lost.
+func (w *BulkResultWriter) Write(result *BulkInvoiceResult) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.wroteHeader {
+		if err := w.w.Write(bulkResultHeader); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	var errMsg string
+	if result.Err != nil {
+		errMsg = result.Err.Error()
+	}
+	record := []string{
+		strconv.Itoa(result.Row),
+		result.ExternalOrderID,
+		result.ID,
+		result.PaymentLink,
+		strconv.FormatBool(result.Created),
+		errMsg,
+	}
+	if err := w.w.Write(record); err != nil {
+		return err
+	}
+	w.w.Flush()
+
+	return w.w.Error()
+}
+
+// ReadBulkResults reads the results written by a BulkResultWriter,
+// to be passed as BulkCreatorOpts.Previous. A truncated last record,
+// left by an interruption, is ignored.
+func ReadBulkResults(r io.Reader) ([]*BulkInvoiceResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(bulkResultHeader)
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	if strings.Join(header, ",") != strings.Join(bulkResultHeader, ",") {
+		return nil, fmt.Errorf("unexpected CSV header %q", header)
+	}
+
+	var results []*BulkInvoiceResult
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return results, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if _, next := cr.Read(); errors.Is(next, io.EOF) {
+				return results, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid row number %q", record[0])
+		}
+		created, _ := strconv.ParseBool(record[4])
+		result := &BulkInvoiceResult{
+			Row:             row,
+			ExternalOrderID: record[1],
+			ID:              record[2],
+			PaymentLink:     record[3],
+			Created:         created,
+		}
+		if record[5] != "" {
+			result.Err = errors.New(record[5])
+		}
+		results = append(results, result)
+	}
+}
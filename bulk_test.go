@@ -0,0 +1,217 @@
+package kunapay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReadInvoiceRequestsCSV(t *testing.T) {
+	in := "amount,asset,externalOrderId,callbackUrl\n" +
+		"100.10,USDT,order-1,https://example.com/callback\n" +
+		"0.5,BTC,order-2,\n"
+
+	got, err := ReadInvoiceRequestsCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ReadInvoiceRequestsCSV returned error: %v", err)
+	}
+
+	want := []*CreateInvoiceRequest{
+		{Amount: "100.10", Asset: "USDT", ExternalOrderID: "order-1", CallbackURL: "https://example.com/callback"},
+		{Amount: "0.5", Asset: "BTC", ExternalOrderID: "order-2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadInvoiceRequestsCSV returned %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadInvoiceRequestsCSV(strings.NewReader("amount,price\n1,2\n")); err == nil {
+		t.Errorf("ReadInvoiceRequestsCSV with unknown column returned nil, want error")
+	}
+}
+
+func TestReadInvoiceRequestsJSONL(t *testing.T) {
+	in := `{"amount":"100.10","asset":"USDT","externalOrderId":"order-1"}` + "\n\n" +
+		`{"amount":"0.5","asset":"BTC","externalOrderId":"order-2","productCategory":"books"}` + "\n"
+
+	got, err := ReadInvoiceRequestsJSONL(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ReadInvoiceRequestsJSONL returned error: %v", err)
+	}
+
+	want := []*CreateInvoiceRequest{
+		{Amount: "100.10", Asset: "USDT", ExternalOrderID: "order-1"},
+		{Amount: "0.5", Asset: "BTC", ExternalOrderID: "order-2", ProductCategory: "books"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadInvoiceRequestsJSONL returned %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadInvoiceRequestsJSONL(strings.NewReader(`{"price":"1"}`)); err == nil {
+		t.Errorf("ReadInvoiceRequestsJSONL with unknown field returned nil, want error")
+	}
+}
+
+func TestBulkCreator_Validate(t *testing.T) {
+	b := NewBulkCreator(nil, nil)
+	err := b.Validate([]*CreateInvoiceRequest{
+		{Amount: "1", Asset: "USDT", ExternalOrderID: "order-1"},
+		{Amount: "1", Asset: "USDT"},
+		{Amount: "-1", Asset: "USDT", ExternalOrderID: "order-1"},
+	})
+
+	var bulkErr *BulkValidationError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("BulkCreator.Validate returned %v, want BulkValidationError", err)
+	}
+	var rows []int
+	for _, e := range bulkErr.Errors {
+		rows = append(rows, e.Row)
+	}
+	if want := []int{2, 3, 3}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("BulkCreator.Validate returned errors in rows %v, want %v", rows, want)
+	}
+}
+
+func TestBulkCreator_Create(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var mu sync.Mutex
+	var created []string
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.URL.Query().Get("externalOrderId") == "order-2" {
+				fmt.Fprint(w, `{"data":[{"id":"existing","status":"CREATED","externalOrderId":"order-2","invoiceAmount":"2","invoiceAssetCode":"USDT"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"data":[]}`)
+			return
+		}
+
+		var req CreateInvoiceRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.ExternalOrderID == "order-4" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":[{"code":"BAD","message":"bad request"}]}`)
+			return
+		}
+		mu.Lock()
+		created = append(created, req.ExternalOrderID)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"data":{"id":"id-%[1]s","paymentLink":"https://example.com/%[1]s"}}`, req.ExternalOrderID)
+	})
+
+	requests := []*CreateInvoiceRequest{
+		{Amount: "1", Asset: "USDT", ExternalOrderID: "order-1"},
+		{Amount: "2", Asset: "USDT", ExternalOrderID: "order-2"},
+		{Amount: "3", Asset: "USDT", ExternalOrderID: "order-3"},
+		{Amount: "4", Asset: "USDT", ExternalOrderID: "order-4"},
+	}
+
+	var out bytes.Buffer
+	writer := NewBulkResultWriter(&out)
+	b := NewBulkCreator(client, &BulkCreatorOpts{
+		Workers:  2,
+		Previous: []*BulkInvoiceResult{{Row: 3, ExternalOrderID: "order-3", ID: "id-order-3", PaymentLink: "https://example.com/order-3", Created: true}},
+		OnResult: writer.Write,
+	})
+	results, err := b.Create(context.Background(), requests)
+	if err != nil {
+		t.Fatalf("BulkCreator.Create returned error: %v", err)
+	}
+
+	want := []*BulkInvoiceResult{
+		{Row: 1, ExternalOrderID: "order-1", ID: "id-order-1", PaymentLink: "https://example.com/order-1", Created: true},
+		{Row: 2, ExternalOrderID: "order-2", ID: "existing"},
+		{Row: 3, ExternalOrderID: "order-3", ID: "id-order-3", PaymentLink: "https://example.com/order-3"},
+	}
+	if !reflect.DeepEqual(results[:3], want) {
+		t.Errorf("BulkCreator.Create returned %+v, want %+v", results[:3], want)
+	}
+	var respErr *ResponseError
+	if !errors.As(results[3].Err, &respErr) {
+		t.Errorf("BulkCreator.Create returned error %v for row 4, want ResponseError", results[3].Err)
+	}
+	if !reflect.DeepEqual(created, []string{"order-1"}) {
+		t.Errorf("BulkCreator.Create created invoices %v, want [order-1]", created)
+	}
+
+	previous, err := ReadBulkResults(&out)
+	if err != nil {
+		t.Fatalf("ReadBulkResults returned error: %v", err)
+	}
+	if len(previous) != 4 {
+		t.Fatalf("ReadBulkResults returned %d results, want 4", len(previous))
+	}
+	for _, result := range previous {
+		if result.ExternalOrderID == "order-4" && result.Err == nil {
+			t.Errorf("ReadBulkResults returned no error for row 4")
+		}
+	}
+}
+
+func TestBulkCreator_CreateInvalid(t *testing.T) {
+	client, _, teardown := setupClient()
+	defer teardown()
+
+	b := NewBulkCreator(client, nil)
+	if _, err := b.Create(context.Background(), []*CreateInvoiceRequest{{Amount: "1"}}); err == nil {
+		t.Errorf("BulkCreator.Create with invalid rows returned nil, want error")
+	}
+}
+
+func TestBulkCreator_CreateOnResultError(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"data":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"id":"id","paymentLink":"https://example.com/id"}}`)
+	})
+
+	writeErr := errors.New("disk full")
+	b := NewBulkCreator(client, &BulkCreatorOpts{
+		Workers:  1,
+		OnResult: func(*BulkInvoiceResult) error { return writeErr },
+	})
+	results, err := b.Create(context.Background(), []*CreateInvoiceRequest{
+		{Amount: "1", Asset: "USDT", ExternalOrderID: "order-1"},
+		{Amount: "1", Asset: "USDT", ExternalOrderID: "order-2"},
+		{Amount: "1", Asset: "USDT", ExternalOrderID: "order-3"},
+	})
+	if !errors.Is(err, writeErr) {
+		t.Errorf("BulkCreator.Create returned error %v, want %v", err, writeErr)
+	}
+	if !errors.Is(results[2].Err, context.Canceled) {
+		t.Errorf("BulkCreator.Create returned error %v for row 3, want %v", results[2].Err, context.Canceled)
+	}
+}
+
+func TestReadBulkResults_truncated(t *testing.T) {
+	in := "row,externalOrderId,id,paymentLink,created,error\n" +
+		"1,order-1,id-1,https://example.com/1,true,\n" +
+		"2,order-2,id-2,https://exa"
+
+	got, err := ReadBulkResults(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ReadBulkResults returned error: %v", err)
+	}
+	want := []*BulkInvoiceResult{{Row: 1, ExternalOrderID: "order-1", ID: "id-1", PaymentLink: "https://example.com/1", Created: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadBulkResults returned %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadBulkResults(strings.NewReader("id,status\n")); err == nil {
+		t.Errorf("ReadBulkResults with unexpected header returned nil, want error")
+	}
+}
@@ -0,0 +1,249 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChunkProgress is the progress of a chunked listing.
+type ChunkProgress struct {
+	// Done is the number of fetched windows out of Total.
+	Done  int
+	Total int
+
+	// Items is the number of items fetched so far, duplicates included.
+	Items int
+}
+
+// ChunkedListerOpts specifies the optional parameters to the ChunkedLister.
+type ChunkedListerOpts struct {
+	// Window is the length of the time windows the range is split into.
+	// It is rounded up to whole seconds, the precision of the API filters.
+	// Defaults to 24 hours.
+	Window time.Duration
+
+	// Workers is the number of windows fetched concurrently. Defaults to 4.
+	// The requests also wait for the rate limiter of the client, if any.
+	Workers int
+
+	// Progress is called after every fetched window.
+	// The calls are serialized.
+	Progress func(p ChunkProgress)
+}
+
+// ChunkedLister lists the transactions or invoices of a long time range by
+// splitting it into windows by creation time and fetching them concurrently.
+// Paging within a short window is faster than through the whole range, and
+// the records created meanwhile only shift the pages of the latest window.
+//
+// The windows are paged by creation time in the default direction of the
+// API, which is not documented. The merged results are deduplicated and
+// sorted, so the direction does not matter.
+type ChunkedLister struct {
+	client *Client
+	opts   ChunkedListerOpts
+}
+
+// NewChunkedLister returns a new ChunkedLister.
+func NewChunkedLister(client *Client, opts *ChunkedListerOpts) *ChunkedLister {
+	o := ChunkedListerOpts{Window: 24 * time.Hour, Workers: 4}
+	if opts != nil {
+		if opts.Window > 0 {
+			o.Window = opts.Window
+		}
+		if opts.Workers > 0 {
+			o.Workers = opts.Workers
+		}
+		o.Progress = opts.Progress
+	}
+	if o.Window%time.Second != 0 {
+		o.Window = o.Window.Truncate(time.Second) + time.Second
+	}
+
+	return &ChunkedLister{client: client, opts: o}
+}
+
+// Transactions returns the transactions created from the from time up to,
+// but not including, the to time, deduplicated by ID and ordered oldest
+// first by creation time and then by ID. The other filters of the options
+// and Expand apply; Take, Skip, CreatedFrom, CreatedTo and OrderBy are ignored.
+func (l *ChunkedLister) Transactions(ctx context.Context, from, to time.Time, opts *TransactionListOpts) ([]*Transaction, error) {
+	var base TransactionListOpts
+	if opts != nil {
+		base = *opts
+	}
+
+	windows := l.windows(from, to)
+	results := make([][]*Transaction, len(windows))
+	err := l.run(ctx, windows, func(ctx context.Context, i int) (int, error) {
+		page := base
+		page.Types, page.Statuses = nil, nil
+		page.OrderBy = TransactionOrderByCreatedAt
+		page.CreatedFrom, page.CreatedTo = &windows[i][0], &windows[i][1]
+		page.Take, page.Skip = invoiceListPageSize, 0
+		for {
+			txs, _, err := l.client.Transaction.list(ctx, &page)
+			if err != nil {
+				return 0, err
+			}
+			for _, tx := range txs {
+				if base.matches(tx) {
+					results[i] = append(results[i], tx)
+				}
+			}
+			if len(txs) < invoiceListPageSize {
+				return len(results[i]), nil
+			}
+			page.Skip += invoiceListPageSize
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	txs, err := mergeCreated(results, from, to, "transaction", func(tx *Transaction) (string, string) {
+		return tx.ID, tx.CreatedAt
+	})
+	if err != nil {
+		return nil, err
+	}
+	if base.Expand {
+		if err := l.client.Transaction.expand(ctx, txs); err != nil {
+			return nil, err
+		}
+	}
+
+	return txs, nil
+}
+
+// Invoices returns the invoices created from the from time up to, but not
+// including, the to time, deduplicated by ID and ordered oldest first by
+// creation time and then by ID. The other filters of the options apply;
+// Take, Skip, CreatedFrom, CreatedTo and OrderBy are ignored.
+func (l *ChunkedLister) Invoices(ctx context.Context, from, to time.Time, opts *InvoiceListOpts) ([]*Invoice, error) {
+	var base InvoiceListOpts
+	if opts != nil {
+		base = *opts
+	}
+
+	windows := l.windows(from, to)
+	results := make([][]*Invoice, len(windows))
+	err := l.run(ctx, windows, func(ctx context.Context, i int) (int, error) {
+		page := base
+		page.OrderBy = InvoiceOrderByCreatedAt
+		page.CreatedFrom, page.CreatedTo = &windows[i][0], &windows[i][1]
+		page.Take, page.Skip = invoiceListPageSize, 0
+		for {
+			invoices, _, err := l.client.Invoice.List(ctx, &page)
+			if err != nil {
+				return 0, err
+			}
+			results[i] = append(results[i], invoices...)
+			if len(invoices) < invoiceListPageSize {
+				return len(results[i]), nil
+			}
+			page.Skip += invoiceListPageSize
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeCreated(results, from, to, "invoice", func(invoice *Invoice) (string, string) {
+		return invoice.ID, invoice.CreatedAt
+	})
+}
+
+// mergeCreated merges the results of the windows into the items created from
+// the from time up to, but not including, the to time, deduplicated by ID and
+// ordered by creation time and then by ID. The key function returns the ID
+// and the creation time of an item, and kind names the items in errors.
+func mergeCreated[T any](results [][]T, from, to time.Time, kind string, key func(item T) (id, createdAt string)) ([]T, error) {
+	type entry struct {
+		item      T
+		id        string
+		createdAt time.Time
+	}
+
+	var entries []entry
+	seen := make(map[string]bool)
+	for _, items := range results {
+		for _, item := range items {
+			id, created := key(item)
+			if seen[id] {
+				continue
+			}
+			t, err := parseTime(created)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", kind, id, err)
+			}
+			seen[id] = true
+			if t.Before(from) || !t.Before(to) {
+				continue
+			}
+			entries = append(entries, entry{item: item, id: id, createdAt: t})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].createdAt.Equal(entries[j].createdAt) {
+			return entries[i].createdAt.Before(entries[j].createdAt)
+		}
+		return entries[i].id < entries[j].id
+	})
+
+	var merged []T
+	for _, e := range entries {
+		merged = append(merged, e.item)
+	}
+
+	return merged, nil
+}
+
+// windows splits the range into windows. The API filters by whole seconds,
+// so the range is widened to whole seconds, and the windows overlap by the
+// boundary second; the results are filtered and deduplicated afterwards.
+func (l *ChunkedLister) windows(from, to time.Time) [][2]time.Time {
+	start := from.Truncate(time.Second)
+	end := to.Truncate(time.Second)
+	if end.Before(to) {
+		end = end.Add(time.Second)
+	}
+
+	var windows [][2]time.Time
+	for s := start; s.Before(end); s = s.Add(l.opts.Window) {
+		e := s.Add(l.opts.Window)
+		if e.After(end) {
+			e = end
+		}
+		windows = append(windows, [2]time.Time{s, e})
+	}
+
+	return windows
+}
+
+// run calls fetch for every window with a bounded number of workers and
+// reports the progress. The first error cancels the remaining windows.
+func (l *ChunkedLister) run(ctx context.Context, windows [][2]time.Time, fetch func(ctx context.Context, i int) (int, error)) error {
+	var mu sync.Mutex
+	progress := ChunkProgress{Total: len(windows)}
+
+	return forEach(ctx, len(windows), l.opts.Workers, func(ctx context.Context, i int) error {
+		n, err := fetch(ctx, i)
+		if err != nil {
+			return fmt.Errorf("window %s - %s: %w", windows[i][0].Format(time.RFC3339), windows[i][1].Format(time.RFC3339), err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Done++
+		progress.Items += n
+		if l.opts.Progress != nil {
+			l.opts.Progress(progress)
+		}
+
+		return nil
+	})
+}
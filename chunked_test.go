@@ -0,0 +1,195 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveCreatedRange serves the items created within the createdFrom and
+// createdTo query parameters, both inclusive, paged by skip and take.
+func serveCreatedRange(t *testing.T, items []string, createdAt func(i int) time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		q := r.URL.Query()
+		from, err1 := time.Parse(time.RFC3339, q.Get("createdFrom"))
+		to, err2 := time.Parse(time.RFC3339, q.Get("createdTo"))
+		if err1 != nil || err2 != nil {
+			t.Errorf("request %s has no created range", r.RequestURI)
+		}
+		if q.Get("orderBy") != "createdAt" {
+			t.Errorf("request %s is not ordered by createdAt", r.RequestURI)
+		}
+		skip, _ := strconv.Atoi(q.Get("skip"))
+		take, _ := strconv.Atoi(q.Get("take"))
+
+		var matched []string
+		for i, item := range items {
+			if c := createdAt(i); !c.Before(from) && !c.After(to) {
+				matched = append(matched, item)
+			}
+		}
+		if skip > len(matched) {
+			skip = len(matched)
+		}
+		matched = matched[skip:]
+		if len(matched) > take {
+			matched = matched[:take]
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(matched, ","))
+	}
+}
+
+func TestChunkedLister_Transactions(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := func(i int) time.Time { return start.Add(time.Duration(i) * 15 * time.Minute) }
+
+	// 300 transactions every 15 minutes, newest first, so the windows have
+	// more than one page and a transaction lies on every window boundary.
+	var items []string
+	for i := 299; i >= 0; i-- {
+		typ := TransactionTypeDeposit
+		if i%3 == 0 {
+			typ = TransactionTypeWithdraw
+		}
+		items = append(items, fmt.Sprintf(`{"id":"%03d","type":%q,"createdAt":%q}`, i, typ, createdAt(i).Format(time.RFC3339Nano)))
+	}
+	createdAtItem := func(i int) time.Time { return createdAt(299 - i) }
+
+	var mu sync.Mutex
+	var requests int
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		serveCreatedRange(t, items, createdAtItem)(w, r)
+	})
+
+	var progress []ChunkProgress
+	lister := NewChunkedLister(client, &ChunkedListerOpts{
+		Window:   25 * time.Hour,
+		Workers:  2,
+		Progress: func(p ChunkProgress) { progress = append(progress, p) },
+	})
+
+	// From the 10th to the 289th transaction, the last one excluded.
+	txs, err := lister.Transactions(context.Background(), createdAt(10), createdAt(289), &TransactionListOpts{
+		Types: []TransactionType{TransactionTypeDeposit},
+	})
+	if err != nil {
+		t.Fatalf("ChunkedLister.Transactions returned error: %v", err)
+	}
+
+	var want []string
+	for i := 10; i < 289; i++ {
+		if i%3 != 0 {
+			want = append(want, fmt.Sprintf("%03d", i))
+		}
+	}
+	var got []string
+	for _, tx := range txs {
+		got = append(got, tx.ID)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ChunkedLister.Transactions returned %v, want %v", got, want)
+	}
+
+	// 69h45m of transactions split into three 25 hour windows.
+	if len(progress) != 3 || progress[2].Done != 3 || progress[2].Total != 3 {
+		t.Errorf("ChunkedLister reported progress %+v, want 3 windows", progress)
+	}
+	if requests != 5 {
+		t.Errorf("ChunkedLister sent %d requests, want 5", requests)
+	}
+}
+
+func TestChunkedLister_Invoices(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := func(i int) time.Time { return start.Add(time.Duration(i) * time.Hour) }
+	var items []string
+	for i := 0; i < 48; i++ {
+		items = append(items, fmt.Sprintf(`{"id":"%02d","createdAt":%q}`, i, createdAt(i).Format(time.RFC3339Nano)))
+	}
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("paymentAssetCode"); got != "USDT" {
+			t.Errorf("ChunkedLister requested paymentAssetCode %q, want USDT", got)
+		}
+		serveCreatedRange(t, items, createdAt)(w, r)
+	})
+
+	invoices, err := NewChunkedLister(client, nil).Invoices(context.Background(), start.Add(-time.Minute), start.Add(48*time.Hour), &InvoiceListOpts{PaymentAssetCode: "USDT"})
+	if err != nil {
+		t.Fatalf("ChunkedLister.Invoices returned error: %v", err)
+	}
+	if len(invoices) != 48 || invoices[0].ID != "00" || invoices[47].ID != "47" {
+		t.Errorf("ChunkedLister.Invoices returned %d invoices", len(invoices))
+	}
+}
+
+func TestChunkedLister_expand(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := func(i int) time.Time { return start.Add(time.Duration(i) * time.Hour) }
+	items := []string{
+		fmt.Sprintf(`{"id":"1","invoiceId":"a","createdAt":%q}`, createdAt(0).Format(time.RFC3339Nano)),
+		fmt.Sprintf(`{"id":"2","createdAt":%q}`, createdAt(30).Format(time.RFC3339Nano)),
+	}
+	mux.HandleFunc("/v1/transaction", serveCreatedRange(t, items, createdAt))
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data":{"id":%q,"externalOrderId":"order"}}`, strings.TrimPrefix(r.URL.Path, "/v1/invoice/"))
+	})
+
+	txs, err := NewChunkedLister(client, nil).Transactions(context.Background(), start, start.Add(48*time.Hour), &TransactionListOpts{Expand: true})
+	if err != nil {
+		t.Fatalf("ChunkedLister.Transactions returned error: %v", err)
+	}
+	if len(txs) != 2 || txs[0].Expanded == nil || txs[0].Expanded.ExternalOrderID != "order" || txs[1].Expanded == nil {
+		t.Errorf("ChunkedLister.Transactions did not expand the transactions")
+	}
+}
+
+func TestChunkedLister_error(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Query().Get("createdFrom"), "2023-07-02") {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"data":[]}`)
+	})
+
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	_, err := NewChunkedLister(client, nil).Transactions(context.Background(), start, start.AddDate(0, 0, 10), nil)
+	if err == nil || !strings.Contains(err.Error(), "window 2023-07-02T00:00:00Z - 2023-07-03T00:00:00Z") {
+		t.Errorf("ChunkedLister.Transactions returned error %v, want window error", err)
+	}
+}
+
+func TestChunkedLister_windows(t *testing.T) {
+	lister := NewChunkedLister(nil, &ChunkedListerOpts{Window: 1500 * time.Millisecond})
+	from := time.Date(2023, 7, 1, 0, 0, 0, 500, time.UTC)
+	windows := lister.windows(from, from.Add(3*time.Second))
+
+	var got []string
+	for _, w := range windows {
+		got = append(got, w[0].Format("05")+"-"+w[1].Format("05"))
+	}
+	if want := "00-02,02-04"; strings.Join(got, ",") != want {
+		t.Errorf("ChunkedLister.windows returned %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package kunapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownCurrency is returned when a currency is not in the catalog.
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Format formats the amount with the precision of the currency,
+// rounding half away from zero.
+func (c *InvoiceCurrency) Format(amount *big.Rat) string {
+	return amount.FloatString(int(c.Precision))
+}
+
+// Parse parses the decimal amount. The amount must not have more decimal
+// places than the precision of the currency.
+func (c *InvoiceCurrency) Parse(s string) (*big.Rat, error) {
+	places, _, _, ok := parseDecimal(s)
+	if !ok {
+		return nil, fmt.Errorf("amount %q is not a decimal number", s)
+	}
+	if int64(places) > c.Precision {
+		return nil, fmt.Errorf("amount %q exceeds %s precision of %d decimal places", s, c.Code, c.Precision)
+	}
+
+	amount, _ := new(big.Rat).SetString(s)
+	return amount, nil
+}
+
+// CurrencyCatalogOpts specifies the optional parameters to the CurrencyCatalog.
+type CurrencyCatalogOpts struct {
+	// TTL is how long the loaded currencies are used before they are
+	// loaded again. Defaults to 1 hour.
+	TTL time.Duration
+
+	// Timeout limits a load of the currencies. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// CurrencyCatalog caches the invoice currencies. All pages of the currencies
+// are loaded on the first use and again once the TTL expires. Concurrent
+// calls share a single load.
+type CurrencyCatalog struct {
+	client *Client
+	opts   CurrencyCatalogOpts
+
+	mu         sync.Mutex
+	currencies []*InvoiceCurrency
+	byCode     map[string]*InvoiceCurrency
+	loadedAt   time.Time
+	loading    *catalogLoad
+
+	now func() time.Time
+}
+
+// catalogLoad is a load of the currencies in progress.
+type catalogLoad struct {
+	done chan struct{}
+	err  error
+}
+
+// NewCurrencyCatalog returns a new CurrencyCatalog.
+func NewCurrencyCatalog(client *Client, opts *CurrencyCatalogOpts) *CurrencyCatalog {
+	o := CurrencyCatalogOpts{TTL: time.Hour, Timeout: 30 * time.Second}
+	if opts != nil {
+		if opts.TTL > 0 {
+			o.TTL = opts.TTL
+		}
+		if opts.Timeout > 0 {
+			o.Timeout = opts.Timeout
+		}
+	}
+
+	return &CurrencyCatalog{client: client, opts: o, now: time.Now}
+}
+
+// All returns all invoice currencies.
+func (c *CurrencyCatalog) All(ctx context.Context) ([]*InvoiceCurrency, error) {
+	if err := c.load(ctx, false); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.currencies, nil
+}
+
+// Lookup returns the currency by its code, which is case-insensitive.
+// If there is no such currency, an error wrapping ErrUnknownCurrency is returned.
+func (c *CurrencyCatalog) Lookup(ctx context.Context, code string) (*InvoiceCurrency, error) {
+	if err := c.load(ctx, false); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	currency, ok := c.byCode[normalizeCode(code)]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+	}
+
+	return currency, nil
+}
+
+// Validate validates the request against the currencies, see CreateInvoiceRequest.Validate.
+// The asset code is matched case-insensitively, like in Lookup.
+func (c *CurrencyCatalog) Validate(ctx context.Context, request *CreateInvoiceRequest) error {
+	currencies, err := c.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	return request.Validate(currencies)
+}
+
+// Refresh loads the currencies again, even if the TTL has not expired.
+func (c *CurrencyCatalog) Refresh(ctx context.Context) error {
+	return c.load(ctx, true)
+}
+
+// load loads the currencies if they are expired, or joins the load in progress.
+func (c *CurrencyCatalog) load(ctx context.Context, force bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if !force && c.byCode != nil && c.now().Sub(c.loadedAt) < c.opts.TTL {
+		c.mu.Unlock()
+		return nil
+	}
+	load := c.loading
+	if load == nil {
+		load = &catalogLoad{done: make(chan struct{})}
+		c.loading = load
+		go c.fetch(ctx, load)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-load.done:
+		return load.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetch loads all pages of the currencies. It runs with the context of the
+// call that started the load, but without its cancelation, so the callers
+// that join the load are not affected when that call gives up.
+func (c *CurrencyCatalog) fetch(ctx context.Context, load *catalogLoad) {
+	ctx, cancel := context.WithTimeout(withoutCancel{ctx}, c.opts.Timeout)
+	defer cancel()
+
+	var currencies []*InvoiceCurrency
+	opts := &InvoiceCurrencyListOpts{Take: invoiceListPageSize}
+	for {
+		page, _, err := c.client.Invoice.GetCurrencies(ctx, opts)
+		if err != nil {
+			load.err = err
+			break
+		}
+		currencies = append(currencies, page...)
+		if len(page) < invoiceListPageSize {
+			break
+		}
+		opts.Skip += invoiceListPageSize
+	}
+
+	c.mu.Lock()
+	if load.err == nil {
+		c.currencies = currencies
+		c.byCode = make(map[string]*InvoiceCurrency, len(currencies))
+		for _, currency := range currencies {
+			c.byCode[normalizeCode(currency.Code)] = currency
+		}
+		c.loadedAt = c.now()
+	}
+	c.loading = nil
+	c.mu.Unlock()
+
+	close(load.done)
+}
+
+// normalizeCode returns the asset code in upper case, as the API uses it.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// withoutCancel is a context with the values of the parent, which is never canceled.
+type withoutCancel struct {
+	context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (withoutCancel) Done() <-chan struct{}       { return nil }
+func (withoutCancel) Err() error                  { return nil }
@@ -0,0 +1,180 @@
+package kunapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInvoiceCurrency_Format(t *testing.T) {
+	usdt := &InvoiceCurrency{Code: "USDT", Precision: 2}
+	tests := map[string]string{
+		"1":        "1.00",
+		"1.005":    "1.01",
+		"-1.005":   "-1.01",
+		"100.1234": "100.12",
+	}
+
+	for in, want := range tests {
+		amount, _ := new(big.Rat).SetString(in)
+		if got := usdt.Format(amount); got != want {
+			t.Errorf("InvoiceCurrency.Format(%s) returned %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestInvoiceCurrency_Parse(t *testing.T) {
+	btc := &InvoiceCurrency{Code: "BTC", Precision: 8}
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "0.00000001", want: "1/100000000"},
+		{in: "1.500000000", want: "3/2"},
+		{in: "-2", want: "-2"},
+		{in: "0", want: "0"},
+		{in: "--1", err: true},
+		{in: "0.000000001", err: true},
+		{in: "1e3", err: true},
+		{in: "1.", err: true},
+		{in: "", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := btc.Parse(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("InvoiceCurrency.Parse(%q) returned nil, want error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("InvoiceCurrency.Parse(%q) returned error: %v", test.in, err)
+			continue
+		}
+		if got.RatString() != test.want {
+			t.Errorf("InvoiceCurrency.Parse(%q) returned %s, want %s", test.in, got.RatString(), test.want)
+		}
+	}
+}
+
+func TestCurrencyCatalog(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var requests int32
+	release := make(chan struct{})
+	mux.HandleFunc("/v1/invoice/assets", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		if r.URL.Query().Get("skip") == "" {
+			currencies := make([]string, invoiceListPageSize)
+			for i := range currencies {
+				currencies[i] = fmt.Sprintf(`{"code":"C%d","precision":2}`, i)
+			}
+			currencies[0] = `{"code":"USDT","precision":2}`
+			fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(currencies, ","))
+			return
+		}
+		testURL(t, r, "/v1/invoice/assets?skip=100&take=100")
+		fmt.Fprint(w, `{"data":[{"code":"BTC","precision":8}]}`)
+	})
+
+	now := time.Date(2023, 7, 30, 0, 0, 0, 0, time.UTC)
+	catalog := NewCurrencyCatalog(client, &CurrencyCatalogOpts{TTL: time.Minute})
+	catalog.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := catalog.Lookup(context.Background(), "usdt"); err != nil {
+				t.Errorf("CurrencyCatalog.Lookup returned error: %v", err)
+			}
+		}()
+	}
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("CurrencyCatalog sent %d requests, want 2", n)
+	}
+
+	btc, err := catalog.Lookup(context.Background(), " btc ")
+	if err != nil || btc.Precision != 8 {
+		t.Errorf("CurrencyCatalog.Lookup returned %+v, %v", btc, err)
+	}
+	if _, err := catalog.Lookup(context.Background(), "DOGE"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("CurrencyCatalog.Lookup returned error %v, want %v", err, ErrUnknownCurrency)
+	}
+	all, _ := catalog.All(context.Background())
+	if len(all) != invoiceListPageSize+1 {
+		t.Errorf("CurrencyCatalog.All returned %d currencies, want %d", len(all), invoiceListPageSize+1)
+	}
+	// Validate normalizes the asset code the same way Lookup does.
+	for _, asset := range []string{"usdt", "Btc"} {
+		if err := catalog.Validate(context.Background(), &CreateInvoiceRequest{Amount: "1.5", Asset: asset}); err != nil {
+			t.Errorf("CurrencyCatalog.Validate with asset %q returned error: %v", asset, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("CurrencyCatalog sent %d requests before TTL, want 2", n)
+	}
+
+	now = now.Add(time.Minute)
+	if err := catalog.Validate(context.Background(), &CreateInvoiceRequest{Amount: "1.001", Asset: "USDT"}); err == nil {
+		t.Errorf("CurrencyCatalog.Validate returned nil, want error")
+	}
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Errorf("CurrencyCatalog sent %d requests after TTL, want 4", n)
+	}
+
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Errorf("CurrencyCatalog.Refresh returned error: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 6 {
+		t.Errorf("CurrencyCatalog sent %d requests after Refresh, want 6", n)
+	}
+}
+
+func TestCurrencyCatalog_loadError(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	fail := true
+	mux.HandleFunc("/v1/invoice/assets", func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"code":"USDT","precision":2}]}`)
+	})
+
+	catalog := NewCurrencyCatalog(client, nil)
+	if _, err := catalog.All(context.Background()); err == nil {
+		t.Errorf("CurrencyCatalog.All returned nil, want error")
+	}
+
+	fail = false
+	if _, err := catalog.Lookup(context.Background(), "USDT"); err != nil {
+		t.Errorf("CurrencyCatalog.Lookup after failed load returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := catalog.Refresh(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("CurrencyCatalog.Refresh returned error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,430 @@
+package kunapay
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The kinds of the payment events.
+const (
+	EventInvoiceStatusChanged  = "invoice.status_changed"
+	EventWithdrawStatusChanged = "withdraw.status_changed"
+)
+
+// Headers of the events forwarded by the HTTPSink.
+const (
+	HeaderEventID        = "X-Kunapay-Event-Id"
+	HeaderEventTimestamp = "X-Kunapay-Event-Timestamp"
+	HeaderEventSignature = "X-Kunapay-Event-Signature"
+)
+
+// DefaultOutboxQuery is the default query used by the SQLOutboxSink. It is
+// written for SQLite. Other databases need their own query: PostgreSQL takes
+// $1 to $5 placeholders, and MySQL uses INSERT IGNORE instead of ON CONFLICT.
+const DefaultOutboxQuery = "INSERT INTO kunapay_outbox (id, kind, object_id, payload, occurred_at) " +
+	"VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING"
+
+// Event represents a payment event published to the event sinks.
+//
+// Events are delivered at least once, so consumers should deduplicate
+// them by ID. The ID is derived from the status change itself and, for
+// invoices, the update time of the invoice details, so the same change
+// reported by a webhook and a poller has the same ID if both carry the
+// details, while an invoice that returns to an earlier status gets a new one.
+type Event struct {
+	ID             string          `json:"id"`
+	Kind           string          `json:"kind"`
+	ObjectID       string          `json:"objectId"`
+	Status         string          `json:"status"`
+	PreviousStatus string          `json:"previousStatus,omitempty"`
+	Source         string          `json:"source,omitempty"`
+	OccurredAt     time.Time       `json:"occurredAt"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// NewInvoiceStatusEvent returns a new event for the invoice status change.
+func NewInvoiceStatusEvent(e *InvoiceEvent) (*Event, error) {
+	event := &Event{
+		Kind:           EventInvoiceStatusChanged,
+		ObjectID:       e.InvoiceID,
+		Status:         string(e.Status),
+		PreviousStatus: string(e.PreviousStatus),
+		Source:         e.Source,
+		OccurredAt:     e.OccurredAt,
+	}
+	if e.Invoice != nil {
+		data, err := json.Marshal(e.Invoice)
+		if err != nil {
+			return nil, err
+		}
+		event.Data = data
+		event.ID = eventID(event, e.Invoice.UpdateAt)
+	} else {
+		event.ID = eventID(event, "")
+	}
+
+	return event, nil
+}
+
+// NewWithdrawStatusEvent returns a new event for the status change
+// of the withdraw transaction.
+func NewWithdrawStatusEvent(tx *Transaction, previousStatus TransactionStatus, source string) (*Event, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{
+		Kind:           EventWithdrawStatusChanged,
+		ObjectID:       tx.ID,
+		Status:         string(tx.Status),
+		PreviousStatus: string(previousStatus),
+		Source:         source,
+		OccurredAt:     time.Now(),
+		Data:           data,
+	}
+	// The transaction statuses do not repeat, so the change identifies the event.
+	event.ID = eventID(event, "")
+
+	return event, nil
+}
+
+// eventID calculates the event ID from the status change and the update time
+// of the object, which tells apart the repeated changes between the same statuses.
+func eventID(e *Event, updatedAt string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n%s", e.Kind, e.ObjectID, e.PreviousStatus, e.Status, updatedAt)
+
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// EventSink receives the published payment events.
+// Publish must be safe for concurrent use.
+type EventSink interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// PublisherOpts specifies the optional parameters to the Publisher.
+type PublisherOpts struct {
+	// MinBackoff is the delay before the first retry of a failed sink.
+	// Defaults to 100 milliseconds.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between the retries. Defaults to 30 seconds.
+	MaxBackoff time.Duration
+}
+
+// PermanentError is returned by an EventSink that will never accept the event,
+// so the Publisher does not retry it.
+type PermanentError struct {
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Publisher fans out the payment events to the sinks.
+//
+// Publish returns only after every sink accepted the event, retrying failed
+// sinks until the context is canceled. Sinks failing with a PermanentError
+// are not retried. Events of the same object are
+// published one at a time, so every sink receives them in order.
+type Publisher struct {
+	sinks      []EventSink
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*objectLock
+}
+
+// objectLock serializes publishing of the events of a single object.
+type objectLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewPublisher returns a new Publisher for the sinks.
+func NewPublisher(opts *PublisherOpts, sinks ...EventSink) *Publisher {
+	p := &Publisher{
+		sinks:      sinks,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+		locks:      make(map[string]*objectLock),
+	}
+	if opts != nil {
+		if opts.MinBackoff > 0 {
+			p.minBackoff = opts.MinBackoff
+		}
+		if opts.MaxBackoff > 0 {
+			p.maxBackoff = opts.MaxBackoff
+		}
+	}
+
+	return p
+}
+
+// Publish delivers the event to every sink.
+// An error is returned if a sink failed permanently, or if the context is done
+// before all sinks accepted the event; it joins the last errors of the failed
+// sinks and the context error.
+func (p *Publisher) Publish(ctx context.Context, e *Event) error {
+	unlock := p.lock(e.ObjectID)
+	defer unlock()
+
+	var permanent []error
+	pending := p.sinks
+	backoff := p.minBackoff
+	for {
+		var (
+			failed []EventSink
+			errs   []error
+		)
+		for _, sink := range pending {
+			err := sink.Publish(ctx, e)
+			var perr *PermanentError
+			switch {
+			case err == nil:
+			case errors.As(err, &perr):
+				permanent = append(permanent, err)
+			default:
+				failed = append(failed, sink)
+				errs = append(errs, err)
+			}
+		}
+		if len(failed) == 0 {
+			if len(permanent) > 0 {
+				return fmt.Errorf("publish event %s: %w", e.ID, errors.Join(permanent...))
+			}
+			return nil
+		}
+		pending = failed
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			errs = append(append(permanent, errs...), ctx.Err())
+			return fmt.Errorf("publish event %s: %w", e.ID, errors.Join(errs...))
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+// InvoiceHandler returns the InvoiceHandler that publishes the invoice status changes.
+func (p *Publisher) InvoiceHandler() InvoiceHandler {
+	return func(ctx context.Context, e *InvoiceEvent) error {
+		event, err := NewInvoiceStatusEvent(e)
+		if err != nil {
+			return err
+		}
+		return p.Publish(ctx, event)
+	}
+}
+
+// lock locks the object and returns the function to unlock it.
+func (p *Publisher) lock(objectID string) func() {
+	p.mu.Lock()
+	l, ok := p.locks[objectID]
+	if !ok {
+		l = &objectLock{}
+		p.locks[objectID] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		p.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(p.locks, objectID)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// ChannelSink publishes the events to a Go channel.
+type ChannelSink struct {
+	ch chan<- *Event
+}
+
+// NewChannelSink returns a new ChannelSink that sends the events to ch.
+func NewChannelSink(ch chan<- *Event) *ChannelSink {
+	return &ChannelSink{ch: ch}
+}
+
+// Publish sends the event to the channel, blocking until it is received
+// or the context is done.
+func (s *ChannelSink) Publish(ctx context.Context, e *Event) error {
+	select {
+	case s.ch <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// JSONLinesSink writes the events as JSON Lines.
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesSink returns a new JSONLinesSink that writes the events to w.
+// If w has a Sync method, like *os.File, it is called after every event.
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// Publish writes the event as a single line.
+func (s *JSONLinesSink) Publish(_ context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	if f, ok := s.w.(interface{ Sync() error }); ok {
+		return f.Sync()
+	}
+
+	return nil
+}
+
+// HTTPSink forwards the events as JSON to an HTTP endpoint.
+//
+// Every request is signed with HMAC-SHA256 of the timestamp and the body,
+// see VerifyEventSignature.
+type HTTPSink struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+}
+
+// NewHTTPSink returns a new HTTPSink that posts the events to the URL.
+// If httpClient is nil, http.DefaultClient is used.
+func NewHTTPSink(url, secret string, httpClient *http.Client) *HTTPSink {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &HTTPSink{url: url, secret: []byte(secret), httpClient: httpClient}
+}
+
+// Publish posts the event. Any response status other than 2xx is an error.
+// A 4xx status other than 408 Request Timeout and 429 Too Many Requests is
+// a PermanentError, since resending the same event will not change it.
+func (s *HTTPSink) Publish(ctx context.Context, e *Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEventID, e.ID)
+	req.Header.Set(HeaderEventTimestamp, ts)
+	req.Header.Set(HeaderEventSignature, signEvent(s.secret, ts, body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > 299 {
+		err := fmt.Errorf("publish event %s: %s returned %d", e.ID, s.url, resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &PermanentError{Err: err}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// VerifyEventSignature reports whether the signature of the event
+// forwarded by the HTTPSink is valid.
+func VerifyEventSignature(secret, timestamp string, body []byte, signature string) bool {
+	want := signEvent([]byte(secret), timestamp, body)
+	return hmac.Equal([]byte(want), []byte(signature))
+}
+
+// signEvent calculates the signature of the event using HMAC-SHA256 algorithm.
+func signEvent(secret []byte, timestamp string, body []byte) string {
+	hash := hmac.New(sha256.New, secret)
+	hash.Write([]byte(timestamp + "."))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SQLOutboxSink stores the events in an outbox table through database/sql.
+type SQLOutboxSink struct {
+	db    *sql.DB
+	query string
+}
+
+// NewSQLOutboxSink returns a new SQLOutboxSink.
+//
+// The query receives the event ID, kind, object ID, JSON encoded event and
+// the time of the change, in that order. It must ignore events with already
+// stored IDs, since the events can be published more than once.
+// If query is empty, DefaultOutboxQuery is used, which only works with SQLite.
+func NewSQLOutboxSink(db *sql.DB, query string) *SQLOutboxSink {
+	if query == "" {
+		query = DefaultOutboxQuery
+	}
+
+	return &SQLOutboxSink{db: db, query: query}
+}
+
+// Publish inserts the event into the outbox table.
+func (s *SQLOutboxSink) Publish(ctx context.Context, e *Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.query, e.ID, e.Kind, e.ObjectID, string(payload), e.OccurredAt)
+
+	return err
+}
@@ -0,0 +1,271 @@
+package kunapay
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewInvoiceStatusEvent(t *testing.T) {
+	webhook, _ := NewInvoiceStatusEvent(&InvoiceEvent{
+		InvoiceID:      "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+		PreviousStatus: InvoiceStatusPaymentAwaiting,
+		Status:         InvoiceStatusPaid,
+		Source:         InvoiceEventSourceWebhook,
+	})
+	poll, _ := NewInvoiceStatusEvent(&InvoiceEvent{
+		InvoiceID:      "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+		PreviousStatus: InvoiceStatusPaymentAwaiting,
+		Status:         InvoiceStatusPaid,
+		Source:         InvoiceEventSourcePoll,
+		Invoice:        &InvoiceDetail{ID: "c94c0c95-e735-45ea-982e-a95f7f52ca49"},
+	})
+
+	if webhook.ID != poll.ID {
+		t.Errorf("NewInvoiceStatusEvent IDs %v and %v differ for the same change", webhook.ID, poll.ID)
+	}
+	if webhook.Kind != EventInvoiceStatusChanged {
+		t.Errorf("NewInvoiceStatusEvent kind is %v, want %v", webhook.Kind, EventInvoiceStatusChanged)
+	}
+	if poll.Data == nil {
+		t.Errorf("NewInvoiceStatusEvent data is nil, want invoice details")
+	}
+
+	// The invoice can move between the same statuses again later.
+	change := func(updatedAt string) string {
+		e, _ := NewInvoiceStatusEvent(&InvoiceEvent{
+			InvoiceID:      "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+			PreviousStatus: InvoiceStatusPaymentAwaiting,
+			Status:         InvoiceStatusPartiallyPaid,
+			Invoice:        &InvoiceDetail{ID: "c94c0c95-e735-45ea-982e-a95f7f52ca49", UpdateAt: updatedAt},
+		})
+		return e.ID
+	}
+	if first, again := change("2023-07-30T10:00:00.000Z"), change("2023-07-30T10:00:00.000Z"); first != again {
+		t.Errorf("NewInvoiceStatusEvent IDs %v and %v differ for the same change", first, again)
+	}
+	if first, second := change("2023-07-30T10:00:00.000Z"), change("2023-07-30T11:00:00.000Z"); first == second {
+		t.Errorf("NewInvoiceStatusEvent ID %v is the same for a repeated change", first)
+	}
+
+	withdraw, _ := NewWithdrawStatusEvent(transactionMock(), TransactionStatusProcessing, InvoiceEventSourcePoll)
+	if withdraw.ID == webhook.ID || withdraw.Kind != EventWithdrawStatusChanged {
+		t.Errorf("NewWithdrawStatusEvent returned %+v", withdraw)
+	}
+}
+
+var errSinkUnavailable = errors.New("sink is unavailable")
+
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	err      error
+	events   []*Event
+}
+
+func (s *flakySink) Publish(_ context.Context, e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.err != nil {
+		return s.err
+	}
+	if s.failures > 0 {
+		s.failures--
+		return errSinkUnavailable
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	ok := &flakySink{}
+	flaky := &flakySink{failures: 2}
+	p := NewPublisher(&PublisherOpts{MinBackoff: time.Millisecond}, ok, flaky)
+
+	e := &Event{ID: "1", ObjectID: "invoice"}
+	if err := p.Publish(context.Background(), e); err != nil {
+		t.Errorf("Publisher.Publish returned error: %v", err)
+	}
+	if len(ok.events) != 1 {
+		t.Errorf("Publisher.Publish delivered %d events to healthy sink, want 1", len(ok.events))
+	}
+	if len(flaky.events) != 1 {
+		t.Errorf("Publisher.Publish delivered %d events to flaky sink, want 1", len(flaky.events))
+	}
+	if len(p.locks) != 0 {
+		t.Errorf("Publisher keeps %d object locks, want 0", len(p.locks))
+	}
+
+	down := &flakySink{failures: 1 << 30}
+	p = NewPublisher(&PublisherOpts{MinBackoff: time.Millisecond}, down)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Publish(ctx, e); !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errSinkUnavailable) {
+		t.Errorf("Publisher.Publish returned %v, want %v and %v", err, errSinkUnavailable, context.DeadlineExceeded)
+	}
+
+	rejected := errors.New("event is rejected")
+	permanent := &flakySink{err: &PermanentError{Err: rejected}}
+	ok = &flakySink{}
+	p = NewPublisher(&PublisherOpts{MinBackoff: time.Millisecond}, permanent, ok)
+	if err := p.Publish(context.Background(), e); !errors.Is(err, rejected) {
+		t.Errorf("Publisher.Publish returned %v, want %v", err, rejected)
+	}
+	if permanent.calls != 1 || len(ok.events) != 1 {
+		t.Errorf("Publisher.Publish called permanently failing sink %d times, want 1", permanent.calls)
+	}
+}
+
+func TestPublisher_InvoiceHandler(t *testing.T) {
+	ch := make(chan *Event, 1)
+	p := NewPublisher(nil, NewChannelSink(ch))
+
+	handler := p.InvoiceHandler()
+	err := handler(context.Background(), &InvoiceEvent{
+		InvoiceID: "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+		Status:    InvoiceStatusPaid,
+	})
+	if err != nil {
+		t.Errorf("Publisher.InvoiceHandler returned error: %v", err)
+	}
+
+	e := <-ch
+	if e.ObjectID != "c94c0c95-e735-45ea-982e-a95f7f52ca49" || e.Status != string(InvoiceStatusPaid) {
+		t.Errorf("ChannelSink received %+v", e)
+	}
+}
+
+func TestChannelSink_PublishCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sink := NewChannelSink(make(chan *Event))
+	if err := sink.Publish(ctx, &Event{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ChannelSink.Publish returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestJSONLinesSink_Publish(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+
+	occurredAt := time.Date(2023, 7, 30, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"1", "2"} {
+		e := &Event{ID: id, Kind: EventInvoiceStatusChanged, ObjectID: "invoice", Status: "PAID", OccurredAt: occurredAt}
+		if err := sink.Publish(context.Background(), e); err != nil {
+			t.Errorf("JSONLinesSink.Publish returned error: %v", err)
+		}
+	}
+
+	want := `{"id":"1","kind":"invoice.status_changed","objectId":"invoice","status":"PAID","occurredAt":"2023-07-30T00:00:00Z"}` + "\n" +
+		`{"id":"2","kind":"invoice.status_changed","objectId":"invoice","status":"PAID","occurredAt":"2023-07-30T00:00:00Z"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("JSONLinesSink wrote %s, want %s", got, want)
+	}
+}
+
+func TestHTTPSink_Publish(t *testing.T) {
+	const secret = "secret"
+
+	var got Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		body, _ := io.ReadAll(r.Body)
+		ts := r.Header.Get(HeaderEventTimestamp)
+		if !VerifyEventSignature(secret, ts, body, r.Header.Get(HeaderEventSignature)) {
+			t.Errorf("HTTPSink request signature is invalid")
+		}
+		if VerifyEventSignature("wrong", ts, body, r.Header.Get(HeaderEventSignature)) {
+			t.Errorf("HTTPSink request signature is valid for wrong secret")
+		}
+		_ = json.Unmarshal(body, &got)
+		switch r.Header.Get(HeaderEventID) {
+		case "fail":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "reject":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, secret, nil)
+	e := &Event{ID: "1", Kind: EventInvoiceStatusChanged, ObjectID: "invoice", Status: "PAID"}
+	if err := sink.Publish(context.Background(), e); err != nil {
+		t.Errorf("HTTPSink.Publish returned error: %v", err)
+	}
+	if !reflect.DeepEqual(&got, e) {
+		t.Errorf("HTTPSink posted %+v, want %+v", got, e)
+	}
+
+	var perr *PermanentError
+	if err := sink.Publish(context.Background(), &Event{ID: "fail"}); err == nil || errors.As(err, &perr) {
+		t.Errorf("HTTPSink.Publish returned %v, want temporary error", err)
+	}
+	if err := sink.Publish(context.Background(), &Event{ID: "reject"}); !errors.As(err, &perr) {
+		t.Errorf("HTTPSink.Publish returned %v, want PermanentError", err)
+	}
+}
+
+func TestSQLOutboxSink_Publish(t *testing.T) {
+	drv := &outboxDriver{}
+	sql.Register("outbox", drv)
+	db, _ := sql.Open("outbox", "")
+	defer db.Close()
+
+	sink := NewSQLOutboxSink(db, "")
+	e := &Event{ID: "1", Kind: EventInvoiceStatusChanged, ObjectID: "invoice", Status: "PAID"}
+	if err := sink.Publish(context.Background(), e); err != nil {
+		t.Errorf("SQLOutboxSink.Publish returned error: %v", err)
+	}
+
+	if drv.query != DefaultOutboxQuery {
+		t.Errorf("SQLOutboxSink executed %q, want %q", drv.query, DefaultOutboxQuery)
+	}
+	if len(drv.args) != 5 || drv.args[0] != "1" || drv.args[1] != EventInvoiceStatusChanged || drv.args[2] != "invoice" {
+		t.Errorf("SQLOutboxSink executed with %v", drv.args)
+	}
+}
+
+// outboxDriver is a database/sql driver that records the executed statement.
+type outboxDriver struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *outboxDriver) Open(string) (driver.Conn, error) { return &outboxConn{d}, nil }
+
+type outboxConn struct{ d *outboxDriver }
+
+func (c *outboxConn) Prepare(query string) (driver.Stmt, error) {
+	return &outboxStmt{d: c.d, query: query}, nil
+}
+func (c *outboxConn) Close() error              { return nil }
+func (c *outboxConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type outboxStmt struct {
+	d     *outboxDriver
+	query string
+}
+
+func (s *outboxStmt) Close() error  { return nil }
+func (s *outboxStmt) NumInput() int { return -1 }
+func (s *outboxStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.query, s.d.args = s.query, args
+	return driver.RowsAffected(1), nil
+}
+func (s *outboxStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
@@ -0,0 +1,80 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+)
+
+// expandWorkers is the number of invoices fetched concurrently
+// when the transactions are expanded.
+const expandWorkers = 4
+
+// TransactionInvoice is the invoice a transaction is joined with when it is
+// listed or got with the Expand option.
+type TransactionInvoice struct {
+	// Invoice is the invoice of the transaction, or nil if the transaction
+	// is not linked to an invoice.
+	Invoice *InvoiceDetail `json:"invoice,omitempty"`
+
+	// The fields of the invoice, empty if the transaction has no invoice.
+	ExternalOrderID    string `json:"externalOrderId,omitempty"`
+	ProductCategory    string `json:"productCategory,omitempty"`
+	ProductDescription string `json:"productDescription,omitempty"`
+}
+
+// expand joins the transactions with their invoices. The invoices are
+// fetched concurrently, each of them once per call.
+func (s *TransactionService) expand(ctx context.Context, txs []*Transaction) error {
+	var ids []string
+	invoices := make(map[string]*InvoiceDetail)
+	for _, tx := range txs {
+		if tx.InvoiceID == "" {
+			continue
+		}
+		if _, ok := invoices[tx.InvoiceID]; !ok {
+			invoices[tx.InvoiceID] = nil
+			ids = append(ids, tx.InvoiceID)
+		}
+	}
+
+	if len(ids) > 0 {
+		details, err := s.invoices(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			invoices[id] = details[i]
+		}
+	}
+
+	for _, tx := range txs {
+		e := &TransactionInvoice{}
+		if inv := invoices[tx.InvoiceID]; inv != nil {
+			e.Invoice = inv
+			e.ExternalOrderID = inv.ExternalOrderID
+			e.ProductCategory = inv.ProductCategory
+			e.ProductDescription = inv.ProductDescription
+		}
+		tx.Expanded = e
+	}
+
+	return nil
+}
+
+// invoices fetches the invoices concurrently, in the same order.
+func (s *TransactionService) invoices(ctx context.Context, ids []string) ([]*InvoiceDetail, error) {
+	details := make([]*InvoiceDetail, len(ids))
+	err := forEach(ctx, len(ids), expandWorkers, func(ctx context.Context, i int) error {
+		detail, _, err := s.client.Invoice.Get(ctx, ids[i])
+		if err != nil {
+			return fmt.Errorf("get invoice %s: %w", ids[i], err)
+		}
+		details[i] = detail
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
@@ -0,0 +1,101 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTransactionService_ListExpand(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		testURL(t, r, "/v1/transaction?asset=USDT")
+		fmt.Fprint(w, `{"data":[
+			{"id":"1","invoiceId":"a"},
+			{"id":"2"},
+			{"id":"3","invoiceId":"b"},
+			{"id":"4","invoiceId":"a"}
+		]}`)
+	})
+
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		id := strings.TrimPrefix(r.URL.Path, "/v1/invoice/")
+		mu.Lock()
+		requests[id]++
+		mu.Unlock()
+		fmt.Fprintf(w, `{"data":{"id":%q,"externalOrderId":"order-%s","productCategory":"category","productDescription":"description"}}`, id, id)
+	})
+
+	txs, _, err := client.Transaction.List(context.Background(), &TransactionListOpts{Asset: "USDT", Expand: true})
+	if err != nil {
+		t.Fatalf("Transaction.List returned error: %v", err)
+	}
+
+	var got []string
+	for _, tx := range txs {
+		got = append(got, fmt.Sprintf("%s:%s:%s", tx.ID, tx.Expanded.ExternalOrderID, tx.Expanded.ProductCategory))
+	}
+	if want := "1:order-a:category 2:: 3:order-b:category 4:order-a:category"; strings.Join(got, " ") != want {
+		t.Errorf("Transaction.List returned %v, want %s", got, want)
+	}
+	if txs[1].Expanded.Invoice != nil || txs[0].Expanded.Invoice != txs[3].Expanded.Invoice {
+		t.Errorf("Transaction.List did not share the invoice of the same ID")
+	}
+	if len(requests) != 2 || requests["a"] != 1 || requests["b"] != 1 {
+		t.Errorf("Transaction.List fetched invoices %v, want a and b once", requests)
+	}
+}
+
+func TestTransactionService_GetExpand(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/transaction/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"id":"1","invoiceId":"a"}}`)
+	})
+	mux.HandleFunc("/v1/invoice/a", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"id":"a","externalOrderId":"order-a","productDescription":"description"}}`)
+	})
+
+	tx, _, err := client.Transaction.Get(context.Background(), "1", &TransactionGetOpts{Expand: true})
+	if err != nil {
+		t.Fatalf("Transaction.Get returned error: %v", err)
+	}
+	if tx.ID != "1" || tx.Expanded == nil || tx.Expanded.Invoice == nil || tx.Expanded.ExternalOrderID != "order-a" || tx.Expanded.ProductDescription != "description" {
+		t.Errorf("Transaction.Get returned %+v", tx)
+	}
+	if data, _ := json.Marshal(tx); strings.Contains(string(data), "order-a") {
+		t.Errorf("json.Marshal(tx) encoded the expanded invoice: %s", data)
+	}
+}
+
+func TestTransactionService_ListExpandInvoiceError(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"id":"1","invoiceId":"a"},{"id":"2","invoiceId":"b"}]}`)
+	})
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/invoice/b" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"id":"a"}}`)
+	})
+
+	_, _, err := client.Transaction.List(context.Background(), &TransactionListOpts{Expand: true})
+	if err == nil || !strings.Contains(err.Error(), "get invoice b") {
+		t.Errorf("Transaction.List returned error %v, want get invoice b error", err)
+	}
+}
@@ -0,0 +1,245 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat is the output format of the InvoiceExporter.
+type ExportFormat int
+
+// The output formats of the InvoiceExporter.
+const (
+	// ExportFormatCSV writes one row per invoice with the InvoiceExportColumns.
+	ExportFormatCSV ExportFormat = iota
+
+	// ExportFormatJSONL writes one InvoiceDetail JSON object per line,
+	// including its transactions.
+	ExportFormatJSONL
+
+	// ExportFormatTransactionsCSV writes one row per invoice transaction
+	// with the InvoiceTransactionExportColumns. Invoices without
+	// transactions are not written.
+	ExportFormatTransactionsCSV
+)
+
+// exportColumn is a CSV column of the export.
+// The transaction is nil for the invoice rows.
+type exportColumn struct {
+	name  string
+	value func(inv *InvoiceDetail, tx *InvoiceTransaction) string
+}
+
+var invoiceExportColumns = []exportColumn{
+	{"id", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ID }},
+	{"status", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return string(inv.Status) }},
+	{"externalOrderId", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ExternalOrderID }},
+	{"addressId", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.AddressID }},
+	{"creatorId", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.CreatorID }},
+	{"invoiceAmount", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.InvoiceAmount }},
+	{"invoiceAssetCode", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.InvoiceAssetCode }},
+	{"paymentAmount", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.PaymentAmount }},
+	{"paymentAssetCode", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.PaymentAssetCode }},
+	{"productCategory", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ProductCategory }},
+	{"productDescription", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ProductDescription }},
+	{"isCreatedByApi", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return strconv.FormatBool(inv.IsCreatedByAPI) }},
+	{"expireAt", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ExpireAt }},
+	{"completedAt", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.CompletedAt }},
+	{"createdAt", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.CreatedAt }},
+	{"updatedAt", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.UpdateAt }},
+	{"transactionCount", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return strconv.Itoa(len(inv.Transactions)) }},
+}
+
+var invoiceTransactionExportColumns = []exportColumn{
+	{"invoiceId", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ID }},
+	{"invoiceStatus", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return string(inv.Status) }},
+	{"externalOrderId", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.ExternalOrderID }},
+	{"invoiceAmount", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.InvoiceAmount }},
+	{"invoiceAssetCode", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.InvoiceAssetCode }},
+	{"invoiceCreatedAt", func(inv *InvoiceDetail, _ *InvoiceTransaction) string { return inv.CreatedAt }},
+	{"transactionId", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.ID }},
+	{"type", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return string(tx.Type) }},
+	{"status", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return string(tx.Status) }},
+	{"asset", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.Asset }},
+	{"amount", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.Amount }},
+	{"processedAmount", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.ProcessedAmount }},
+	{"fee", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.Fee }},
+	{"address", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.Address }},
+	{"paymentCode", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.PaymentCode }},
+	{"reason", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return strings.Join(tx.Reason, "; ") }},
+	{"creatorComment", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.CreatorComment }},
+	{"createdAt", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.CreatedAt }},
+	{"updatedAt", func(_ *InvoiceDetail, tx *InvoiceTransaction) string { return tx.UpdatedAt }},
+}
+
+// InvoiceExportColumns are the CSV columns of the ExportFormatCSV format, in order.
+// The columns are named after the InvoiceDetail JSON fields, and transactionCount
+// is the number of the invoice transactions. New columns are only ever appended.
+var InvoiceExportColumns = columnNames(invoiceExportColumns)
+
+// InvoiceTransactionExportColumns are the CSV columns of the ExportFormatTransactionsCSV
+// format, in order. The columns starting with invoice and externalOrderId describe
+// the invoice, and the rest are named after the InvoiceTransaction JSON fields.
+// Multiple reasons are joined with "; ". New columns are only ever appended.
+var InvoiceTransactionExportColumns = columnNames(invoiceTransactionExportColumns)
+
+func columnNames(columns []exportColumn) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+
+	return names
+}
+
+// InvoiceExporterOpts specifies the optional parameters to the InvoiceExporter.
+type InvoiceExporterOpts struct {
+	// Format is the output format. Defaults to ExportFormatCSV.
+	Format ExportFormat
+
+	// Workers is the number of invoice details fetched concurrently. Defaults to 4.
+	Workers int
+
+	// PageSize is the number of invoices listed per request. Defaults to 100.
+	PageSize int64
+}
+
+// InvoiceExporter writes the invoices with their details.
+type InvoiceExporter struct {
+	client *Client
+	opts   InvoiceExporterOpts
+}
+
+// NewInvoiceExporter returns a new InvoiceExporter.
+func NewInvoiceExporter(client *Client, opts *InvoiceExporterOpts) *InvoiceExporter {
+	o := InvoiceExporterOpts{Workers: 4, PageSize: invoiceListPageSize}
+	if opts != nil {
+		o.Format = opts.Format
+		if opts.Workers > 0 {
+			o.Workers = opts.Workers
+		}
+		if opts.PageSize > 0 {
+			o.PageSize = opts.PageSize
+		}
+	}
+
+	return &InvoiceExporter{client: client, opts: o}
+}
+
+// Export writes the invoices matching the filters of opts, e.g. CreatedFrom and
+// CreatedTo, and returns the number of exported invoices. Take and Skip are
+// ignored, all pages are exported. The invoices are written page by page,
+// so only a single page is kept in memory.
+func (e *InvoiceExporter) Export(ctx context.Context, w io.Writer, opts *InvoiceListOpts) (int, error) {
+	write, flush, err := e.writer(w)
+	if err != nil {
+		return 0, err
+	}
+
+	list := InvoiceListOpts{}
+	if opts != nil {
+		list = *opts
+	}
+	list.Take = e.opts.PageSize
+	list.Skip = 0
+
+	var n int
+	for {
+		invoices, _, err := e.client.Invoice.List(ctx, &list)
+		if err != nil {
+			return n, err
+		}
+
+		details, err := e.details(ctx, invoices)
+		if err != nil {
+			return n, err
+		}
+		for _, detail := range details {
+			if err := write(detail); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := flush(); err != nil {
+			return n, err
+		}
+
+		if int64(len(invoices)) < list.Take {
+			return n, nil
+		}
+		list.Skip += list.Take
+	}
+}
+
+// writer returns the functions that write an invoice and flush the output.
+func (e *InvoiceExporter) writer(w io.Writer) (write func(*InvoiceDetail) error, flush func() error, err error) {
+	switch e.opts.Format {
+	case ExportFormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(inv *InvoiceDetail) error { return enc.Encode(inv) }
+		return write, func() error { return nil }, nil
+	case ExportFormatCSV, ExportFormatTransactionsCSV:
+	default:
+		return nil, nil, fmt.Errorf("unknown export format %d", e.opts.Format)
+	}
+
+	cw := csv.NewWriter(w)
+	flush = func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+
+	columns := invoiceExportColumns
+	if e.opts.Format == ExportFormatTransactionsCSV {
+		columns = invoiceTransactionExportColumns
+	}
+	if err := cw.Write(columnNames(columns)); err != nil {
+		return nil, nil, err
+	}
+
+	record := make([]string, len(columns))
+	row := func(inv *InvoiceDetail, tx *InvoiceTransaction) error {
+		for i, c := range columns {
+			record[i] = c.value(inv, tx)
+		}
+		return cw.Write(record)
+	}
+	if e.opts.Format == ExportFormatCSV {
+		return func(inv *InvoiceDetail) error { return row(inv, nil) }, flush, nil
+	}
+
+	return func(inv *InvoiceDetail) error {
+		for i := range inv.Transactions {
+			if err := row(inv, &inv.Transactions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, flush, nil
+}
+
+// details fetches the details of the invoices concurrently, in the same order.
+func (e *InvoiceExporter) details(ctx context.Context, invoices []*Invoice) ([]*InvoiceDetail, error) {
+	details := make([]*InvoiceDetail, len(invoices))
+	err := forEach(ctx, len(invoices), e.opts.Workers, func(ctx context.Context, i int) error {
+		detail, _, err := e.client.Invoice.Get(ctx, invoices[i].ID)
+		if err != nil {
+			return fmt.Errorf("get invoice %s: %w", invoices[i].ID, err)
+		}
+		if detail == nil {
+			return fmt.Errorf("get invoice %s: empty response", invoices[i].ID)
+		}
+		details[i] = detail
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
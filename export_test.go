@@ -0,0 +1,167 @@
+package kunapay
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupExport(t *testing.T) (*Client, func()) {
+	client, mux, teardown := setupClient()
+
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		switch r.URL.Query().Get("skip") {
+		case "":
+			testURL(t, r, "/v1/invoice?createdFrom=2023-07-01T00%3A00%3A00Z&take=2")
+			fmt.Fprint(w, `{"data":[{"id":"first"},{"id":"second"}]}`)
+		case "2":
+			fmt.Fprint(w, `{"data":[{"id":"third"}]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	})
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/invoice/")
+		var transactions string
+		switch id {
+		case "first":
+			transactions = `[{"id":"tx-1","type":"INVOICE","status":"PROCESSED","amount":"10","reason":["a","b"]},{"id":"tx-2","type":"INVOICE","status":"CREATED","amount":"5"}]`
+		case "third":
+			transactions = `[{"id":"tx-3","type":"INVOICE","status":"CANCELED","amount":"1"}]`
+		default:
+			transactions = `[]`
+		}
+		fmt.Fprintf(w, `{"data":{"id":%q,"status":"PAID","invoiceAmount":"15","invoiceAssetCode":"USDT","transactions":%s}}`, id, transactions)
+	})
+
+	return client, teardown
+}
+
+func TestInvoiceExporter_ExportCSV(t *testing.T) {
+	client, teardown := setupExport(t)
+	defer teardown()
+
+	from := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	n, err := NewInvoiceExporter(client, &InvoiceExporterOpts{PageSize: 2}).Export(context.Background(), &out, &InvoiceListOpts{CreatedFrom: &from, Take: 1000})
+	if err != nil {
+		t.Fatalf("InvoiceExporter.Export returned error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("InvoiceExporter.Export returned %d, want 3", n)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("csv.ReadAll returned error: %v", err)
+	}
+	if !reflect.DeepEqual(records[0], InvoiceExportColumns) {
+		t.Errorf("InvoiceExporter.Export header is %v, want %v", records[0], InvoiceExportColumns)
+	}
+	var ids, counts []string
+	for _, record := range records[1:] {
+		ids = append(ids, record[0])
+		counts = append(counts, record[len(record)-1])
+	}
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("InvoiceExporter.Export wrote invoices %v, want %v", ids, want)
+	}
+	if want := []string{"2", "0", "1"}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("InvoiceExporter.Export wrote transaction counts %v, want %v", counts, want)
+	}
+}
+
+func TestInvoiceExporter_ExportTransactionsCSV(t *testing.T) {
+	client, teardown := setupExport(t)
+	defer teardown()
+
+	from := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	e := NewInvoiceExporter(client, &InvoiceExporterOpts{Format: ExportFormatTransactionsCSV, PageSize: 2, Workers: 1})
+	if _, err := e.Export(context.Background(), &out, &InvoiceListOpts{CreatedFrom: &from}); err != nil {
+		t.Fatalf("InvoiceExporter.Export returned error: %v", err)
+	}
+
+	want := strings.Join(InvoiceTransactionExportColumns, ",") + "\n" +
+		"first,PAID,,15,USDT,,tx-1,INVOICE,PROCESSED,,10,,,,,a; b,,,\n" +
+		"first,PAID,,15,USDT,,tx-2,INVOICE,CREATED,,5,,,,,,,,\n" +
+		"third,PAID,,15,USDT,,tx-3,INVOICE,CANCELED,,1,,,,,,,,\n"
+	if got := out.String(); got != want {
+		t.Errorf("InvoiceExporter.Export wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInvoiceExporter_ExportJSONL(t *testing.T) {
+	client, teardown := setupExport(t)
+	defer teardown()
+
+	from := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	e := NewInvoiceExporter(client, &InvoiceExporterOpts{Format: ExportFormatJSONL, PageSize: 2})
+	if _, err := e.Export(context.Background(), &out, &InvoiceListOpts{CreatedFrom: &from}); err != nil {
+		t.Fatalf("InvoiceExporter.Export returned error: %v", err)
+	}
+
+	dec := json.NewDecoder(&out)
+	var transactions int
+	for dec.More() {
+		var detail InvoiceDetail
+		if err := dec.Decode(&detail); err != nil {
+			t.Fatalf("json.Decode returned error: %v", err)
+		}
+		transactions += len(detail.Transactions)
+	}
+	if transactions != 3 {
+		t.Errorf("InvoiceExporter.Export wrote %d transactions, want 3", transactions)
+	}
+}
+
+func TestInvoiceExporter_ExportDetailError(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("externalOrderId") == "empty" {
+			fmt.Fprint(w, `{"data":[{"id":"empty"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"id":"first"},{"id":"missing"}]}`)
+	})
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/invoice/missing":
+			http.NotFound(w, r)
+		case "/v1/invoice/empty":
+			fmt.Fprint(w, `{"data":null}`)
+		default:
+			fmt.Fprint(w, `{"data":{"id":"first"}}`)
+		}
+	})
+
+	var out bytes.Buffer
+	n, err := NewInvoiceExporter(client, nil).Export(context.Background(), &out, nil)
+	if err == nil || !strings.Contains(err.Error(), "get invoice missing") {
+		t.Errorf("InvoiceExporter.Export returned error %v, want error for invoice missing", err)
+	}
+	if n != 0 {
+		t.Errorf("InvoiceExporter.Export returned %d, want 0", n)
+	}
+
+	// An invoice without details fails the export instead of dropping the page.
+	_, err = NewInvoiceExporter(client, nil).Export(context.Background(), &out, &InvoiceListOpts{ExternalOrderID: "empty"})
+	if err == nil || !strings.Contains(err.Error(), "get invoice empty") {
+		t.Errorf("InvoiceExporter.Export returned error %v, want error for invoice empty", err)
+	}
+
+	if _, err := NewInvoiceExporter(client, &InvoiceExporterOpts{Format: ExportFormat(9)}).Export(context.Background(), &out, nil); err == nil {
+		t.Errorf("InvoiceExporter.Export with unknown format returned nil, want error")
+	}
+}
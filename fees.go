@@ -0,0 +1,387 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RateSource provides the exchange rates to convert the fees to a reporting currency.
+type RateSource interface {
+	// Rate returns the price of one unit of the asset in the currency at the time.
+	Rate(ctx context.Context, asset, currency string, at time.Time) (*big.Rat, error)
+}
+
+// FeeReportOpts specifies the optional parameters to the FeeReportBuilder.
+type FeeReportOpts struct {
+	// Period groups the fees by day or week. Defaults to SummaryPeriodDay.
+	Period SummaryPeriod
+
+	// Location is the time zone of the day and week boundaries. Defaults to UTC.
+	Location *time.Location
+
+	// Currency and Rates convert the amounts and fees to the reporting currency
+	// at the rate of the start of each period. Both must be set to convert.
+	Currency string
+	Rates    RateSource
+
+	// CurrencyPrecision is the number of decimal places of the converted
+	// amounts. If nil, it defaults to 2.
+	CurrencyPrecision *int
+
+	// OutlierFactor flags the transactions whose effective fee rate is more
+	// than the factor times the median rate of their asset and type.
+	// An asset and type with a zero median rate, mostly free transactions,
+	// has no outliers. Defaults to 3.
+	OutlierFactor float64
+}
+
+// FeeGroup is the fees of the transactions of an asset and type in a period.
+type FeeGroup struct {
+	// Period is the start of the period.
+	Period time.Time       `json:"period"`
+	Asset  string          `json:"asset"`
+	Type   TransactionType `json:"type"`
+	Count  int             `json:"count"`
+
+	// Amount and Fee are the sums in the asset.
+	Amount string `json:"amount"`
+	Fee    string `json:"fee"`
+
+	// EffectiveRate is Fee divided by Amount, or 0 if Amount is 0.
+	EffectiveRate float64 `json:"effectiveRate"`
+
+	// ConvertedAmount and ConvertedFee are the sums in the reporting
+	// currency, empty if the fees are not converted.
+	ConvertedAmount string `json:"convertedAmount,omitempty"`
+	ConvertedFee    string `json:"convertedFee,omitempty"`
+}
+
+// FeeOutlier is a transaction with an unusually high effective fee rate.
+type FeeOutlier struct {
+	TransactionID string          `json:"transactionId"`
+	Asset         string          `json:"asset"`
+	Type          TransactionType `json:"type"`
+	Time          time.Time       `json:"time"`
+	Amount        string          `json:"amount"`
+	Fee           string          `json:"fee"`
+	EffectiveRate float64         `json:"effectiveRate"`
+
+	// MedianRate is the median effective rate of the asset and type.
+	MedianRate float64 `json:"medianRate"`
+}
+
+// FeeReport is the fees of the transactions grouped by period, asset and type.
+type FeeReport struct {
+	// Currency is the reporting currency, empty if the fees are not converted.
+	Currency string `json:"currency,omitempty"`
+
+	// Groups are ordered by period, asset and type.
+	Groups []*FeeGroup `json:"groups"`
+
+	// TotalFee is the sum of the fees in the reporting currency,
+	// empty if the fees are not converted.
+	TotalFee string `json:"totalFee,omitempty"`
+
+	Outliers []*FeeOutlier `json:"outliers"`
+}
+
+// FeeReportColumns are the CSV columns written by FeeReport.WriteCSV, in order.
+var FeeReportColumns = []string{"period", "asset", "type", "count", "amount", "fee", "effectiveRate", "convertedAmount", "convertedFee"}
+
+// WriteCSV writes the groups of the report as CSV.
+func (r *FeeReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(FeeReportColumns); err != nil {
+		return err
+	}
+	for _, g := range r.Groups {
+		record := []string{
+			g.Period.Format(time.RFC3339),
+			g.Asset,
+			string(g.Type),
+			strconv.Itoa(g.Count),
+			g.Amount,
+			g.Fee,
+			strconv.FormatFloat(g.EffectiveRate, 'f', -1, 64),
+			g.ConvertedAmount,
+			g.ConvertedFee,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteJSON writes the report as JSON.
+func (r *FeeReport) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// FeeReportBuilder aggregates the fees of the processed transactions.
+// Transactions are identified by ID, so a transaction added both as
+// a Transaction and as an InvoiceTransaction is counted once.
+// It is not safe for concurrent use.
+type FeeReportBuilder struct {
+	opts      FeeReportOpts
+	precision int
+	fees      map[string]*feeRecord
+}
+
+// feeRecord is a processed transaction with a fee.
+type feeRecord struct {
+	id     string
+	asset  string
+	typ    TransactionType
+	time   time.Time
+	amount *big.Rat
+	fee    *big.Rat
+
+	// amountStr and feeStr are the amounts as received.
+	amountStr string
+	feeStr    string
+}
+
+// NewFeeReportBuilder returns a new FeeReportBuilder.
+func NewFeeReportBuilder(opts *FeeReportOpts) *FeeReportBuilder {
+	o := FeeReportOpts{Location: time.UTC, OutlierFactor: 3}
+	precision := 2
+	if opts != nil {
+		o.Period = opts.Period
+		if opts.Location != nil {
+			o.Location = opts.Location
+		}
+		o.Currency = opts.Currency
+		o.Rates = opts.Rates
+		if opts.CurrencyPrecision != nil {
+			precision = *opts.CurrencyPrecision
+		}
+		if opts.OutlierFactor > 0 {
+			o.OutlierFactor = opts.OutlierFactor
+		}
+	}
+
+	return &FeeReportBuilder{opts: o, precision: precision, fees: make(map[string]*feeRecord)}
+}
+
+// AddTransaction adds the transaction if it is processed.
+func (b *FeeReportBuilder) AddTransaction(tx *Transaction) error {
+	return b.add(tx.ID, tx.Asset, tx.Type, tx.Status, tx.Amount, tx.ProcessedAmount, tx.Fee, tx.CreatedAt)
+}
+
+// AddInvoiceTransaction adds the invoice transaction if it is processed.
+func (b *FeeReportBuilder) AddInvoiceTransaction(tx *InvoiceTransaction) error {
+	return b.add(tx.ID, tx.Asset, tx.Type, tx.Status, tx.Amount, tx.ProcessedAmount, tx.Fee, tx.CreatedAt)
+}
+
+// AddInvoice adds the processed transactions of the invoice.
+func (b *FeeReportBuilder) AddInvoice(detail *InvoiceDetail) error {
+	for i := range detail.Transactions {
+		if err := b.AddInvoiceTransaction(&detail.Transactions[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *FeeReportBuilder) add(id, asset string, typ TransactionType, status TransactionStatus, amount, processedAmount, fee, createdAt string) error {
+	if !status.IsSuccessful() {
+		return nil
+	}
+	if processedAmount != "" {
+		amount = processedAmount
+	}
+	if fee == "" {
+		fee = "0"
+	}
+
+	r := &feeRecord{id: id, asset: asset, typ: typ, amountStr: amount, feeStr: fee}
+	var err error
+	if r.time, err = parseTime(createdAt); err != nil {
+		return fmt.Errorf("transaction %s: %w", id, err)
+	}
+	var ok bool
+	if r.amount, ok = new(big.Rat).SetString(amount); !ok {
+		return fmt.Errorf("transaction %s amount %q is not a decimal number", id, amount)
+	}
+	if r.fee, ok = new(big.Rat).SetString(fee); !ok {
+		return fmt.Errorf("transaction %s fee %q is not a decimal number", id, fee)
+	}
+	b.fees[id] = r
+
+	return nil
+}
+
+// feeGroupKey identifies a FeeGroup.
+type feeGroupKey struct {
+	period time.Time
+	asset  string
+	typ    TransactionType
+}
+
+// Build builds the report. The rates are requested once per asset and period.
+func (b *FeeReportBuilder) Build(ctx context.Context) (*FeeReport, error) {
+	convert := b.opts.Currency != "" && b.opts.Rates != nil
+	summaryOpts := InvoiceSummaryOpts{Period: b.opts.Period, Location: b.opts.Location}
+
+	type groupSums struct {
+		*FeeGroup
+		amount, fee     *big.Rat
+		amountPl, feePl int
+	}
+	groups := make(map[feeGroupKey]*groupSums)
+	for _, r := range b.fees {
+		key := feeGroupKey{period: periodStart(r.time, summaryOpts), asset: r.asset, typ: r.typ}
+		g := groups[key]
+		if g == nil {
+			g = &groupSums{
+				FeeGroup: &FeeGroup{Period: key.period, Asset: key.asset, Type: key.typ},
+				amount:   new(big.Rat),
+				fee:      new(big.Rat),
+			}
+			groups[key] = g
+		}
+		g.Count++
+		g.amount.Add(g.amount, r.amount)
+		g.fee.Add(g.fee, r.fee)
+		if n := decimalScale(r.amountStr); n > g.amountPl {
+			g.amountPl = n
+		}
+		if n := decimalScale(r.feeStr); n > g.feePl {
+			g.feePl = n
+		}
+	}
+
+	type rateKey struct {
+		asset  string
+		period time.Time
+	}
+	rates := make(map[rateKey]*big.Rat)
+
+	report := &FeeReport{Groups: []*FeeGroup{}, Outliers: []*FeeOutlier{}}
+	total := new(big.Rat)
+	for key, g := range groups {
+		g.Amount = g.amount.FloatString(g.amountPl)
+		g.Fee = g.fee.FloatString(g.feePl)
+		g.EffectiveRate = feeRate(g.fee, g.amount)
+
+		if convert {
+			rk := rateKey{asset: key.asset, period: key.period}
+			rate := rates[rk]
+			if rate == nil {
+				var err error
+				rate, err = b.opts.Rates.Rate(ctx, key.asset, b.opts.Currency, key.period)
+				if err != nil {
+					return nil, fmt.Errorf("rate of %s in %s: %w", key.asset, b.opts.Currency, err)
+				}
+				rates[rk] = rate
+			}
+			fee := new(big.Rat).Mul(g.fee, rate)
+			g.ConvertedAmount = new(big.Rat).Mul(g.amount, rate).FloatString(b.precision)
+			g.ConvertedFee = fee.FloatString(b.precision)
+			total.Add(total, fee)
+		}
+		report.Groups = append(report.Groups, g.FeeGroup)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		gi, gj := report.Groups[i], report.Groups[j]
+		if !gi.Period.Equal(gj.Period) {
+			return gi.Period.Before(gj.Period)
+		}
+		if gi.Asset != gj.Asset {
+			return gi.Asset < gj.Asset
+		}
+		return gi.Type < gj.Type
+	})
+	if convert {
+		report.Currency = b.opts.Currency
+		report.TotalFee = total.FloatString(b.precision)
+	}
+	report.Outliers = b.outliers()
+
+	return report, nil
+}
+
+// minOutlierSamples is the number of transactions of an asset and type
+// needed to flag outliers among them.
+const minOutlierSamples = 3
+
+// outliers returns the transactions with an effective fee rate above the
+// outlier factor times the median rate of their asset and type, oldest first.
+// Every fee is above a zero median, so such assets and types are skipped.
+func (b *FeeReportBuilder) outliers() []*FeeOutlier {
+	type kind struct {
+		asset string
+		typ   TransactionType
+	}
+	records := make(map[kind][]*feeRecord)
+	for _, r := range b.fees {
+		if r.amount.Sign() > 0 {
+			k := kind{r.asset, r.typ}
+			records[k] = append(records[k], r)
+		}
+	}
+
+	outliers := []*FeeOutlier{}
+	for _, rs := range records {
+		if len(rs) < minOutlierSamples {
+			continue
+		}
+		rates := make([]float64, len(rs))
+		for i, r := range rs {
+			rates[i] = feeRate(r.fee, r.amount)
+		}
+		sorted := append([]float64(nil), rates...)
+		sort.Float64s(sorted)
+		median := sorted[len(sorted)/2]
+		if len(sorted)%2 == 0 {
+			median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+		}
+		if median == 0 {
+			continue
+		}
+
+		for i, r := range rs {
+			if rates[i] > median*b.opts.OutlierFactor {
+				outliers = append(outliers, &FeeOutlier{
+					TransactionID: r.id,
+					Asset:         r.asset,
+					Type:          r.typ,
+					Time:          r.time,
+					Amount:        r.amountStr,
+					Fee:           r.feeStr,
+					EffectiveRate: rates[i],
+					MedianRate:    median,
+				})
+			}
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		if !outliers[i].Time.Equal(outliers[j].Time) {
+			return outliers[i].Time.Before(outliers[j].Time)
+		}
+		return outliers[i].TransactionID < outliers[j].TransactionID
+	})
+
+	return outliers
+}
+
+// feeRate returns fee divided by amount, or 0 if amount is 0.
+func feeRate(fee, amount *big.Rat) float64 {
+	if amount.Sign() == 0 {
+		return 0
+	}
+	rate, _ := new(big.Rat).Quo(fee, amount).Float64()
+
+	return rate
+}
@@ -0,0 +1,179 @@
+package kunapay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rateSourceFunc adapts a function to the RateSource interface.
+type rateSourceFunc func(ctx context.Context, asset, currency string, at time.Time) (*big.Rat, error)
+
+func (f rateSourceFunc) Rate(ctx context.Context, asset, currency string, at time.Time) (*big.Rat, error) {
+	return f(ctx, asset, currency, at)
+}
+
+func TestFeeReportBuilder(t *testing.T) {
+	var calls []string
+	rates := rateSourceFunc(func(_ context.Context, asset, currency string, at time.Time) (*big.Rat, error) {
+		calls = append(calls, fmt.Sprintf("%s/%s@%s", asset, currency, at.Format("01-02")))
+		if asset == "BTC" {
+			return big.NewRat(30000, 1), nil
+		}
+		return big.NewRat(1, 1), nil
+	})
+	b := NewFeeReportBuilder(&FeeReportOpts{Currency: "USD", Rates: rates})
+
+	for _, tx := range []*Transaction{
+		{ID: "1", Type: TransactionTypeDeposit, Status: TransactionStatusProcessed, Asset: "USDT", Amount: "100.00", Fee: "1.00", CreatedAt: "2023-07-01T10:00:00.000Z"},
+		{ID: "2", Type: TransactionTypeDeposit, Status: TransactionStatusProcessed, Asset: "USDT", Amount: "200.00", Fee: "2.00", CreatedAt: "2023-07-01T11:00:00.000Z"},
+		{ID: "3", Type: TransactionTypeDeposit, Status: TransactionStatusPartiallyProcessed, Asset: "USDT", Amount: "100.00", ProcessedAmount: "50.00", Fee: "5.00", CreatedAt: "2023-07-01T12:00:00.000Z"},
+		{ID: "4", Type: TransactionTypeDeposit, Status: TransactionStatusCanceled, Asset: "USDT", Amount: "100.00", Fee: "1.00", CreatedAt: "2023-07-01T12:00:00.000Z"},
+		{ID: "5", Type: TransactionTypeWithdraw, Status: TransactionStatusProcessed, Asset: "USDT", Amount: "10.00", Fee: "1.00", CreatedAt: "2023-07-01T13:00:00.000Z"},
+		{ID: "6", Type: TransactionTypeWithdraw, Status: TransactionStatusProcessed, Asset: "BTC", Amount: "0.01", Fee: "0.0001", CreatedAt: "2023-07-02T13:00:00.000Z"},
+	} {
+		if err := b.AddTransaction(tx); err != nil {
+			t.Fatalf("FeeReportBuilder.AddTransaction returned error: %v", err)
+		}
+	}
+	// The invoice transaction 1 is the same as the transaction 1.
+	err := b.AddInvoice(&InvoiceDetail{Transactions: []InvoiceTransaction{
+		{ID: "1", Type: "Deposit", Status: TransactionStatusProcessed, Asset: "USDT", Amount: "100.00", Fee: "1.00", CreatedAt: "2023-07-01T10:00:00.000Z"},
+		{ID: "7", Type: "Deposit", Status: TransactionStatusProcessed, Asset: "USDT", Amount: "100.00", Fee: "1.00", CreatedAt: "2023-07-02T10:00:00.000Z"},
+	}})
+	if err != nil {
+		t.Fatalf("FeeReportBuilder.AddInvoice returned error: %v", err)
+	}
+
+	report, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("FeeReportBuilder.Build returned error: %v", err)
+	}
+
+	var groups []string
+	for _, g := range report.Groups {
+		groups = append(groups, fmt.Sprintf("%s %s %s %d %s %s %g %s %s",
+			g.Period.Format("01-02"), g.Asset, g.Type, g.Count, g.Amount, g.Fee, g.EffectiveRate, g.ConvertedAmount, g.ConvertedFee))
+	}
+	want := []string{
+		"07-01 USDT Deposit 3 350.00 8.00 0.022857142857142857 350.00 8.00",
+		"07-01 USDT Withdraw 1 10.00 1.00 0.1 10.00 1.00",
+		"07-02 BTC Withdraw 1 0.01 0.0001 0.01 300.00 3.00",
+		"07-02 USDT Deposit 1 100.00 1.00 0.01 100.00 1.00",
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("FeeReport.Groups are\n%s\nwant\n%s", strings.Join(groups, "\n"), strings.Join(want, "\n"))
+	}
+	if report.Currency != "USD" || report.TotalFee != "13.00" {
+		t.Errorf("FeeReport total is %s %s, want 13.00 USD", report.TotalFee, report.Currency)
+	}
+	if len(calls) != 3 {
+		t.Errorf("FeeReportBuilder.Build requested rates %v, want 3", calls)
+	}
+
+	// The partially processed deposit paid 10% against the 1% median of the deposits.
+	if len(report.Outliers) != 1 || report.Outliers[0].TransactionID != "3" || report.Outliers[0].MedianRate != 0.01 {
+		t.Errorf("FeeReport.Outliers are %+v, want transaction 3", report.Outliers)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("FeeReport.WriteCSV returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[3] != "2023-07-02T00:00:00Z,BTC,Withdraw,1,0.01,0.0001,0.01,300.00,3.00" {
+		t.Errorf("FeeReport.WriteCSV wrote\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("FeeReport.WriteJSON returned error: %v", err)
+	}
+	var decoded FeeReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Groups) != 4 {
+		t.Errorf("FeeReport.WriteJSON wrote %s", buf.String())
+	}
+}
+
+func TestFeeReportBuilder_withoutConversion(t *testing.T) {
+	b := NewFeeReportBuilder(&FeeReportOpts{Period: SummaryPeriodWeek})
+	if err := b.AddTransaction(&Transaction{ID: "1", Status: TransactionStatusProcessed, Amount: "0", CreatedAt: "2023-07-05T00:00:00.000Z"}); err != nil {
+		t.Fatalf("FeeReportBuilder.AddTransaction returned error: %v", err)
+	}
+	report, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("FeeReportBuilder.Build returned error: %v", err)
+	}
+	g := report.Groups[0]
+	if g.Period.Format("2006-01-02") != "2023-07-03" || g.Fee != "0" || g.EffectiveRate != 0 || g.ConvertedFee != "" || report.TotalFee != "" {
+		t.Errorf("FeeReport.Groups[0] is %+v, total %q", g, report.TotalFee)
+	}
+}
+
+func TestFeeReportBuilder_zeroPrecision(t *testing.T) {
+	rates := rateSourceFunc(func(_ context.Context, asset, currency string, at time.Time) (*big.Rat, error) {
+		return big.NewRat(145, 1), nil
+	})
+	precision := 0
+	b := NewFeeReportBuilder(&FeeReportOpts{Currency: "JPY", Rates: rates, CurrencyPrecision: &precision})
+	if err := b.AddTransaction(&Transaction{ID: "1", Type: TransactionTypeDeposit, Status: TransactionStatusProcessed, Asset: "USDT", Amount: "10.50", Fee: "0.25", CreatedAt: "2023-07-05T00:00:00.000Z"}); err != nil {
+		t.Fatalf("FeeReportBuilder.AddTransaction returned error: %v", err)
+	}
+	report, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("FeeReportBuilder.Build returned error: %v", err)
+	}
+	g := report.Groups[0]
+	if g.ConvertedAmount != "1523" || g.ConvertedFee != "36" || report.TotalFee != "36" {
+		t.Errorf("FeeReport.Groups[0] is %+v, total %q", g, report.TotalFee)
+	}
+}
+
+func TestFeeReportBuilder_zeroMedian(t *testing.T) {
+	b := NewFeeReportBuilder(nil)
+	for i, fee := range []string{"0", "0", "0.5"} {
+		tx := &Transaction{ID: fmt.Sprint(i), Type: TransactionTypeDeposit, Status: TransactionStatusProcessed, Asset: "USDT", Amount: "100", Fee: fee, CreatedAt: "2023-07-05T00:00:00.000Z"}
+		if err := b.AddTransaction(tx); err != nil {
+			t.Fatalf("FeeReportBuilder.AddTransaction returned error: %v", err)
+		}
+	}
+	report, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("FeeReportBuilder.Build returned error: %v", err)
+	}
+	if len(report.Outliers) != 0 {
+		t.Errorf("FeeReport.Outliers are %+v, want none for a zero median", report.Outliers)
+	}
+}
+
+func TestFeeReportBuilder_errors(t *testing.T) {
+	b := NewFeeReportBuilder(nil)
+	for _, tx := range []*Transaction{
+		{ID: "1", Status: TransactionStatusProcessed, Amount: "1", CreatedAt: "today"},
+		{ID: "2", Status: TransactionStatusProcessed, Amount: "one", CreatedAt: "2023-07-05T00:00:00.000Z"},
+		{ID: "3", Status: TransactionStatusProcessed, Amount: "1", Fee: "x", CreatedAt: "2023-07-05T00:00:00.000Z"},
+	} {
+		if err := b.AddTransaction(tx); err == nil {
+			t.Errorf("FeeReportBuilder.AddTransaction(%+v) returned nil, want error", tx)
+		}
+	}
+
+	rateErr := errors.New("rates are down")
+	b = NewFeeReportBuilder(&FeeReportOpts{
+		Currency: "USD",
+		Rates: rateSourceFunc(func(context.Context, string, string, time.Time) (*big.Rat, error) {
+			return nil, rateErr
+		}),
+	})
+	_ = b.AddTransaction(&Transaction{ID: "1", Status: TransactionStatusProcessed, Asset: "BTC", Amount: "1", CreatedAt: "2023-07-05T00:00:00.000Z"})
+	if _, err := b.Build(context.Background()); !errors.Is(err, rateErr) {
+		t.Errorf("FeeReportBuilder.Build returned error %v, want %v", err, rateErr)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/vorobeyme/kunapay-go/qr"
 )
 
 // InvoiceService handles communication with the invoice related.
@@ -14,38 +16,109 @@ type InvoiceService struct {
 	client *Client
 }
 
+// InvoiceStatus is the status of the invoice.
+type InvoiceStatus string
+
 // The statuses of the invoice.
 const (
-	InvoiceStatusCreated              = "CREATED"
-	InvoiceStatusPaymentAwaiting      = "PAYMENT_AWAITING"
-	InvoiceStatusConfirmetionAwaiting = "CONFIRMATION_AWAITING"
-	InvoiceStatusLimitsOutOfRange     = "LIMITS_OUT_OF_RANGE"
-	InvoiceStatusPaid                 = "PAID"
-	InvoiceStatusPartiallyPaid        = "PARTIALLY_PAID"
-	InvoiceStatusTimeout              = "TIMEOUT"
-	InvoiceStatusDeactivated          = "DEACTIVATED"
-	InvoiceStatusDeclined             = "DECLINED"
+	InvoiceStatusCreated              InvoiceStatus = "CREATED"
+	InvoiceStatusPaymentAwaiting      InvoiceStatus = "PAYMENT_AWAITING"
+	InvoiceStatusConfirmationAwaiting InvoiceStatus = "CONFIRMATION_AWAITING"
+	InvoiceStatusLimitsOutOfRange     InvoiceStatus = "LIMITS_OUT_OF_RANGE"
+	InvoiceStatusPaid                 InvoiceStatus = "PAID"
+	InvoiceStatusPartiallyPaid        InvoiceStatus = "PARTIALLY_PAID"
+	InvoiceStatusTimeout              InvoiceStatus = "TIMEOUT"
+	InvoiceStatusDeactivated          InvoiceStatus = "DEACTIVATED"
+	InvoiceStatusDeclined             InvoiceStatus = "DECLINED"
+
+	// Deprecated: Use InvoiceStatusConfirmationAwaiting instead.
+	InvoiceStatusConfirmetionAwaiting = InvoiceStatusConfirmationAwaiting
 )
 
+// invoiceTransitions lists the statuses the invoice can move to from
+// the non-terminal statuses.
+var invoiceTransitions = map[InvoiceStatus][]InvoiceStatus{
+	InvoiceStatusCreated: {
+		InvoiceStatusPaymentAwaiting, InvoiceStatusConfirmationAwaiting, InvoiceStatusPartiallyPaid,
+		InvoiceStatusPaid, InvoiceStatusLimitsOutOfRange, InvoiceStatusTimeout,
+		InvoiceStatusDeactivated, InvoiceStatusDeclined,
+	},
+	InvoiceStatusPaymentAwaiting: {
+		InvoiceStatusConfirmationAwaiting, InvoiceStatusPartiallyPaid, InvoiceStatusPaid,
+		InvoiceStatusLimitsOutOfRange, InvoiceStatusTimeout, InvoiceStatusDeactivated,
+		InvoiceStatusDeclined,
+	},
+	InvoiceStatusConfirmationAwaiting: {
+		InvoiceStatusPaymentAwaiting, InvoiceStatusPartiallyPaid, InvoiceStatusPaid,
+		InvoiceStatusLimitsOutOfRange, InvoiceStatusTimeout, InvoiceStatusDeclined,
+	},
+	InvoiceStatusPartiallyPaid: {
+		InvoiceStatusPaymentAwaiting, InvoiceStatusConfirmationAwaiting, InvoiceStatusPaid,
+		InvoiceStatusLimitsOutOfRange, InvoiceStatusTimeout, InvoiceStatusDeactivated,
+		InvoiceStatusDeclined,
+	},
+}
+
+// IsTerminal reports whether the invoice can no longer change its status.
+func (s InvoiceStatus) IsTerminal() bool {
+	switch s {
+	case InvoiceStatusPaid,
+		InvoiceStatusTimeout,
+		InvoiceStatusDeactivated,
+		InvoiceStatusDeclined,
+		InvoiceStatusLimitsOutOfRange:
+		return true
+	}
+
+	return false
+}
+
+// IsSuccessful reports whether the invoice is fully paid.
+func (s InvoiceStatus) IsSuccessful() bool {
+	return s == InvoiceStatusPaid
+}
+
+// CanTransitionTo reports whether the invoice can move from the status to next.
+// Staying in the same status is always possible. Transitions involving
+// statuses unknown to the library are allowed.
+func (s InvoiceStatus) CanTransitionTo(next InvoiceStatus) bool {
+	if s == next || !s.known() || !next.known() {
+		return true
+	}
+	for _, status := range invoiceTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// known reports whether the status is known to the library.
+func (s InvoiceStatus) known() bool {
+	_, ok := invoiceTransitions[s]
+	return ok || s.IsTerminal()
+}
+
 // Invoice represents a KunaPay invoice response.
 type Invoice struct {
-	ID               string `json:"id"`
-	Status           string `json:"status"`
-	AddressID        string `json:"addressId"`
-	ExternalOrderID  string `json:"externalOrderId"`
-	PaymentAmount    string `json:"paymentAmount"`
-	InvoiceAmount    string `json:"invoiceAmount"`
-	InvoiceAssetCode string `json:"invoiceAssetCode"`
-	PaymentAssetCode string `json:"paymentAssetCode"`
-	ExpireAt         string `json:"expireAt"`
-	CompletedAt      string `json:"completedAt"`
-	CreatedAt        string `json:"createdAt"`
+	ID               string        `json:"id"`
+	Status           InvoiceStatus `json:"status"`
+	AddressID        string        `json:"addressId"`
+	ExternalOrderID  string        `json:"externalOrderId"`
+	PaymentAmount    string        `json:"paymentAmount"`
+	InvoiceAmount    string        `json:"invoiceAmount"`
+	InvoiceAssetCode string        `json:"invoiceAssetCode"`
+	PaymentAssetCode string        `json:"paymentAssetCode"`
+	ExpireAt         string        `json:"expireAt"`
+	CompletedAt      string        `json:"completedAt"`
+	CreatedAt        string        `json:"createdAt"`
 }
 
 // InvoiceDetail represents a KunaPay invoice details response.
 type InvoiceDetail struct {
 	ID                 string               `json:"id"`
-	Status             string               `json:"status"`
+	Status             InvoiceStatus        `json:"status"`
 	ExternalOrderID    string               `json:"externalOrderId"`
 	AddressID          string               `json:"addressId"`
 	CreatorID          string               `json:"creatorId"`
@@ -65,19 +138,19 @@ type InvoiceDetail struct {
 
 // Transactions represents a KunaPay transactions associated with the invoice.
 type InvoiceTransaction struct {
-	Address         string   `json:"address"`
-	Amount          string   `json:"amount"`
-	Asset           string   `json:"asset"`
-	CreatorComment  string   `json:"creatorComment"`
-	Fee             string   `json:"fee"`
-	ID              string   `json:"id"`
-	ProcessedAmount string   `json:"processedAmount"`
-	Reason          []string `json:"reason"`
-	Status          string   `json:"status"`
-	Type            string   `json:"type"`
-	CreatedAt       string   `json:"createdAt"`
-	UpdatedAt       string   `json:"updatedAt"`
-	PaymentCode     string   `json:"paymentCode"`
+	Address         string            `json:"address"`
+	Amount          string            `json:"amount"`
+	Asset           string            `json:"asset"`
+	CreatorComment  string            `json:"creatorComment"`
+	Fee             string            `json:"fee"`
+	ID              string            `json:"id"`
+	ProcessedAmount string            `json:"processedAmount"`
+	Reason          []string          `json:"reason"`
+	Status          TransactionStatus `json:"status"`
+	Type            TransactionType   `json:"type"`
+	CreatedAt       string            `json:"createdAt"`
+	UpdatedAt       string            `json:"updatedAt"`
+	PaymentCode     string            `json:"paymentCode"`
 }
 
 // InvoiceCurrency represents a KunaPay invoice currencies response.
@@ -94,6 +167,15 @@ type InvoiceCurrency struct {
 	} `json:"icons"`
 }
 
+// The length limits of the CreateInvoiceRequest fields. The API does not
+// document them, so they are conservative guesses rather than API limits.
+const (
+	maxExternalOrderIDLength    = 255
+	maxProductDescriptionLength = 1000
+	maxProductCategoryLength    = 255
+)
+
+// CreateInvoiceRequest represents a request to create an invoice.
 type CreateInvoiceRequest struct {
 	Amount             string `json:"amount"`
 	Asset              string `json:"asset"`
@@ -103,16 +185,60 @@ type CreateInvoiceRequest struct {
 	CallbackURL        string `json:"callbackUrl,omitempty"`
 }
 
-// validate checks if the request values are valid.
+// validate checks if the request values are valid, without the currencies.
 func (r *CreateInvoiceRequest) validate() error {
-	if strings.TrimSpace(r.Amount) == "" {
-		return fmt.Errorf("amount is required")
+	return r.Validate(nil)
+}
+
+// Validate checks if the request values are valid and returns
+// a *ValidationError with all invalid fields.
+//
+// If currencies are given, as returned by InvoiceService.GetCurrencies,
+// the asset must be one of them, compared case-insensitively, and the amount
+// must fit its precision.
+func (r *CreateInvoiceRequest) Validate(currencies []*InvoiceCurrency) error {
+	var v ValidationError
+
+	places, validAmount := decimalPlaces(r.Amount)
+	switch {
+	case strings.TrimSpace(r.Amount) == "":
+		v.add("amount", "amount is required")
+	case !validAmount:
+		v.add("amount", "amount %q is not a positive decimal number", r.Amount)
 	}
+
 	if strings.TrimSpace(r.Asset) == "" {
-		return fmt.Errorf("asset code is required")
+		v.add("asset", "asset code is required")
+	} else if currencies != nil {
+		var currency *InvoiceCurrency
+		for _, c := range currencies {
+			if normalizeCode(c.Code) == normalizeCode(r.Asset) {
+				currency = c
+				break
+			}
+		}
+		if currency == nil {
+			v.add("asset", "asset code %q is not supported", r.Asset)
+		} else if validAmount && int64(places) > currency.Precision {
+			v.add("amount", "amount %q exceeds %s precision of %d decimal places", r.Amount, currency.Code, currency.Precision)
+		}
 	}
 
-	return nil
+	if n := len([]rune(r.ExternalOrderID)); n > maxExternalOrderIDLength {
+		v.add("externalOrderId", "external order ID is longer than %d characters", maxExternalOrderIDLength)
+	}
+	if n := len([]rune(r.ProductDescription)); n > maxProductDescriptionLength {
+		v.add("productDescription", "product description is longer than %d characters", maxProductDescriptionLength)
+	}
+	if n := len([]rune(r.ProductCategory)); n > maxProductCategoryLength {
+		v.add("productCategory", "product category is longer than %d characters", maxProductCategoryLength)
+	}
+
+	if r.CallbackURL != "" && !isHTTPSURL(r.CallbackURL) {
+		v.add("callbackUrl", "callback URL %q is not an absolute https URL", r.CallbackURL)
+	}
+
+	return v.err()
 }
 
 type CreateInvoiceResponse struct {
@@ -120,8 +246,22 @@ type CreateInvoiceResponse struct {
 	PaymentLink string `json:"paymentLink"`
 }
 
+// QRCode encodes the payment link as a QR code with the error correction level.
+func (r *CreateInvoiceResponse) QRCode(level qr.Level) (*qr.Code, error) {
+	if strings.TrimSpace(r.PaymentLink) == "" {
+		return nil, fmt.Errorf("payment link is required")
+	}
+
+	return qr.Encode(r.PaymentLink, level)
+}
+
 // Create creates invoice for a client for a specified amount.
 //
+// Create checks only the structure of the request, since it does not know
+// the supported currencies. To check the asset and the amount precision too,
+// validate the request with CreateInvoiceRequest.Validate or
+// CurrencyCatalog.Validate first.
+//
 // API docs: https://docs-pay.kuna.io/reference/invoicecontroller_createinvoice
 func (s *InvoiceService) Create(ctx context.Context, request *CreateInvoiceRequest) (*CreateInvoiceResponse, *Response, error) {
 	if err := request.validate(); err != nil {
@@ -257,6 +397,102 @@ func (s *InvoiceService) Get(ctx context.Context, id string) (*InvoiceDetail, *R
 	return root.Data, resp, err
 }
 
+// invoiceListPageSize is the number of invoices requested per page
+// when the invoices are looked up page by page.
+const invoiceListPageSize = 100
+
+// InvoiceConflictError is returned by InvoiceService.GetOrCreate when an open
+// invoice with the same external order ID has a different amount or asset.
+type InvoiceConflictError struct {
+	ExternalOrderID string
+	Invoice         *Invoice
+	Amount          string
+	Asset           string
+}
+
+// Error returns the string representation of the error.
+func (e *InvoiceConflictError) Error() string {
+	return fmt.Sprintf("invoice %s for external order %s is %s %s, want %s %s",
+		e.Invoice.ID, e.ExternalOrderID,
+		e.Invoice.InvoiceAmount, e.Invoice.InvoiceAssetCode,
+		e.Amount, e.Asset,
+	)
+}
+
+// GetOrCreateInvoiceResponse represents the result of the
+// InvoiceService.GetOrCreate method.
+type GetOrCreateInvoiceResponse struct {
+	ID string
+
+	// PaymentLink is only returned for a created invoice,
+	// since the invoices list does not include it.
+	PaymentLink string
+
+	// Created reports whether a new invoice was created.
+	Created bool
+
+	// Invoice is the existing invoice that was reused, or nil.
+	Invoice *Invoice
+}
+
+// GetOrCreate returns the open invoice with the request external order ID,
+// or creates a new one if there is none. An existing invoice is reused only
+// if its amount and asset match the request, otherwise *InvoiceConflictError
+// is returned. Invoices in a terminal status are ignored.
+//
+// The lookup and the creation are not atomic, so concurrent calls with the same
+// external order ID may still create duplicates.
+func (s *InvoiceService) GetOrCreate(ctx context.Context, request *CreateInvoiceRequest) (*GetOrCreateInvoiceResponse, *Response, error) {
+	if strings.TrimSpace(request.ExternalOrderID) == "" {
+		return nil, nil, fmt.Errorf("external order ID is required")
+	}
+	if err := request.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var conflict *Invoice
+	opts := &InvoiceListOpts{
+		Take:            invoiceListPageSize,
+		ExternalOrderID: request.ExternalOrderID,
+	}
+	for {
+		invoices, resp, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, invoice := range invoices {
+			if invoice.ExternalOrderID != request.ExternalOrderID || invoice.Status.IsTerminal() {
+				continue
+			}
+			if normalizeCode(invoice.InvoiceAssetCode) == normalizeCode(request.Asset) && equalDecimals(invoice.InvoiceAmount, request.Amount) {
+				return &GetOrCreateInvoiceResponse{ID: invoice.ID, Invoice: invoice}, resp, nil
+			}
+			if conflict == nil {
+				conflict = invoice
+			}
+		}
+		if len(invoices) < invoiceListPageSize {
+			if conflict != nil {
+				return nil, resp, &InvoiceConflictError{
+					ExternalOrderID: request.ExternalOrderID,
+					Invoice:         conflict,
+					Amount:          request.Amount,
+					Asset:           request.Asset,
+				}
+			}
+			break
+		}
+		opts.Skip += invoiceListPageSize
+	}
+
+	created, resp, err := s.Create(ctx, request)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return &GetOrCreateInvoiceResponse{ID: created.ID, PaymentLink: created.PaymentLink, Created: true}, resp, nil
+}
+
 // InvoiceUpdateOpts specifies the optional parameters to the
 // InvoiceService.Currencies method.
 type InvoiceCurrencyListOpts struct {
@@ -301,3 +537,92 @@ func (s *InvoiceService) GetCurrencies(ctx context.Context, opts *InvoiceCurrenc
 
 	return root.Data, resp, err
 }
+
+// InvoiceWaitOpts specifies the optional parameters to the
+// InvoiceService.Wait method.
+type InvoiceWaitOpts struct {
+	// Statuses to wait for in addition to the terminal ones.
+	Statuses []InvoiceStatus
+
+	// MinInterval is the delay after the first poll and after every
+	// observed status change. Defaults to one second.
+	MinInterval time.Duration
+
+	// MaxInterval is the maximum delay between the polls. Defaults to 30 seconds.
+	MaxInterval time.Duration
+}
+
+// InvoiceStatusChange represents an invoice status observed by the InvoiceService.Wait method.
+type InvoiceStatusChange struct {
+	Status     InvoiceStatus
+	ObservedAt time.Time
+}
+
+// Wait polls the invoice until it reaches one of the requested statuses or any
+// terminal one, doubling the delay between the polls while the status stays the same.
+// It returns the last fetched invoice and the history of the observed statuses.
+// If the context is done first, the invoice and the history observed so far
+// are returned together with the context error.
+func (s *InvoiceService) Wait(ctx context.Context, id string, opts *InvoiceWaitOpts) (*InvoiceDetail, []InvoiceStatusChange, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, nil, fmt.Errorf("invoice ID is required")
+	}
+
+	minInterval, maxInterval := time.Second, 30*time.Second
+	var statuses []InvoiceStatus
+	if opts != nil {
+		if opts.MinInterval > 0 {
+			minInterval = opts.MinInterval
+		}
+		if opts.MaxInterval > 0 {
+			maxInterval = opts.MaxInterval
+		}
+		statuses = opts.Statuses
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+
+	var (
+		invoice  *InvoiceDetail
+		history  []InvoiceStatusChange
+		interval = minInterval
+	)
+	for {
+		detail, _, err := s.Get(ctx, id)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return invoice, history, ctxErr
+			}
+			return invoice, history, err
+		}
+		if detail == nil {
+			return invoice, history, fmt.Errorf("invoice %s: empty response", id)
+		}
+		invoice = detail
+
+		if len(history) == 0 || history[len(history)-1].Status != detail.Status {
+			history = append(history, InvoiceStatusChange{Status: detail.Status, ObservedAt: time.Now()})
+			interval = minInterval
+		} else if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+
+		if detail.Status.IsTerminal() {
+			return invoice, history, nil
+		}
+		for _, status := range statuses {
+			if detail.Status == status {
+				return invoice, history, nil
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return invoice, history, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -2,11 +2,15 @@ package kunapay
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/vorobeyme/kunapay-go/qr"
 )
 
 func TestInvoiceService_Marshal(t *testing.T) {
@@ -113,16 +117,96 @@ func TestInvoiceService_CreateWithRequestValidationErr(t *testing.T) {
 	defer teardown()
 
 	ctx := context.Background()
-	_, _, amountErr := client.Invoice.Create(ctx, &CreateInvoiceRequest{})
-	if amountErr != nil && amountErr.Error() != "amount is required" {
-		t.Errorf("Invoice.Create returned error: %v", amountErr)
+	_, _, err := client.Invoice.Create(ctx, &CreateInvoiceRequest{})
+	if err == nil || err.Error() != "amount is required; asset code is required" {
+		t.Errorf("Invoice.Create returned error: %v", err)
 	}
 	_, _, assetErr := client.Invoice.Create(ctx, &CreateInvoiceRequest{Amount: "100.00"})
-	if amountErr != nil && assetErr.Error() != "asset code is required" {
+	if assetErr == nil || assetErr.Error() != "asset code is required" {
 		t.Errorf("Invoice.Create returned error: %v", assetErr)
 	}
 }
 
+func TestCreateInvoiceRequest_Validate(t *testing.T) {
+	currencies := []*InvoiceCurrency{
+		{Code: "USDT", Precision: 2},
+		{Code: "BTC", Precision: 8},
+	}
+
+	tests := []struct {
+		title   string
+		request CreateInvoiceRequest
+		fields  []string
+	}{
+		{"valid", CreateInvoiceRequest{Amount: "100.10", Asset: "USDT"}, nil},
+		{"valid with all fields", CreateInvoiceRequest{
+			Amount:             "0.00000001",
+			Asset:              "BTC",
+			ExternalOrderID:    strings.Repeat("x", maxExternalOrderIDLength),
+			ProductDescription: "Product description",
+			ProductCategory:    "Product category",
+			CallbackURL:        "https://example.com/callback",
+		}, nil},
+		{"zero amount", CreateInvoiceRequest{Amount: "0.00", Asset: "USDT"}, []string{"amount"}},
+		{"negative amount", CreateInvoiceRequest{Amount: "-1", Asset: "USDT"}, []string{"amount"}},
+		{"malformed amount", CreateInvoiceRequest{Amount: "1e3", Asset: "USDT"}, []string{"amount"}},
+		{"amount exceeds precision", CreateInvoiceRequest{Amount: "1.001", Asset: "USDT"}, []string{"amount"}},
+		{"unsupported asset", CreateInvoiceRequest{Amount: "1", Asset: "DOGE"}, []string{"asset"}},
+		{"lower case asset", CreateInvoiceRequest{Amount: "1.01", Asset: "usdt"}, nil},
+		{"lower case asset exceeds precision", CreateInvoiceRequest{Amount: "1.001", Asset: "usdt"}, []string{"amount"}},
+		{"all violations", CreateInvoiceRequest{
+			Amount:             "1.",
+			ExternalOrderID:    strings.Repeat("x", maxExternalOrderIDLength+1),
+			ProductDescription: strings.Repeat("x", maxProductDescriptionLength+1),
+			ProductCategory:    strings.Repeat("x", maxProductCategoryLength+1),
+			CallbackURL:        "http://example.com/callback",
+		}, []string{"amount", "asset", "externalOrderId", "productDescription", "productCategory", "callbackUrl"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			err := test.request.Validate(currencies)
+			if test.fields == nil {
+				if err != nil {
+					t.Errorf("CreateInvoiceRequest.Validate returned error: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("CreateInvoiceRequest.Validate returned %v, want *ValidationError", err)
+			}
+			var fields []string
+			for _, e := range verr.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("CreateInvoiceRequest.Validate returned fields %v, want %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestCreateInvoiceResponse_QRCode(t *testing.T) {
+	r := &CreateInvoiceResponse{
+		ID:          "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+		PaymentLink: "https://example.com/invoice/c94c0c95-e735-45ea-982e-a95f7f52ca49",
+	}
+
+	code, err := r.QRCode(qr.Medium)
+	if err != nil {
+		t.Fatalf("CreateInvoiceResponse.QRCode returned error: %v", err)
+	}
+	if code.Level() != qr.Medium || code.Version() != 5 {
+		t.Errorf("CreateInvoiceResponse.QRCode returned level %v and version %v, want %v and 5", code.Level(), code.Version(), qr.Medium)
+	}
+
+	if _, err := (&CreateInvoiceResponse{}).QRCode(qr.Medium); err == nil {
+		t.Errorf("CreateInvoiceResponse.QRCode without payment link returned nil, want error")
+	}
+}
+
 func TestInvoiceService_List(t *testing.T) {
 	client, mux, teardown := setupClient()
 	defer teardown()
@@ -410,6 +494,218 @@ func TestInvoiceService_GetCurrencies(t *testing.T) {
 	})
 }
 
+func TestInvoiceService_Wait(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	statuses := []InvoiceStatus{
+		InvoiceStatusCreated,
+		InvoiceStatusPaymentAwaiting,
+		InvoiceStatusPaymentAwaiting,
+		InvoiceStatusConfirmationAwaiting,
+		InvoiceStatusPaid,
+	}
+	var polls int
+	mux.HandleFunc("/v1/invoice/c94c0c95-e735-45ea-982e-a95f7f52ca49", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprintf(w, `{"data":{"id":"c94c0c95-e735-45ea-982e-a95f7f52ca49","status":%q}}`, statuses[polls])
+		polls++
+	})
+
+	ctx := context.Background()
+	opts := &InvoiceWaitOpts{MinInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+	invoice, history, err := client.Invoice.Wait(ctx, "c94c0c95-e735-45ea-982e-a95f7f52ca49", opts)
+	if err != nil {
+		t.Errorf("Invoice.Wait returned error: %v", err)
+	}
+	if invoice.Status != InvoiceStatusPaid {
+		t.Errorf("Invoice.Wait returned status %v, want %v", invoice.Status, InvoiceStatusPaid)
+	}
+
+	var got []InvoiceStatus
+	for _, h := range history {
+		got = append(got, h.Status)
+	}
+	want := []InvoiceStatus{
+		InvoiceStatusCreated,
+		InvoiceStatusPaymentAwaiting,
+		InvoiceStatusConfirmationAwaiting,
+		InvoiceStatusPaid,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Invoice.Wait returned history %v, want %v", got, want)
+	}
+
+	// Wait stops at the requested non-terminal status.
+	polls = 0
+	opts.Statuses = []InvoiceStatus{InvoiceStatusPaymentAwaiting}
+	invoice, _, err = client.Invoice.Wait(ctx, "c94c0c95-e735-45ea-982e-a95f7f52ca49", opts)
+	if err != nil {
+		t.Errorf("Invoice.Wait returned error: %v", err)
+	}
+	if invoice.Status != InvoiceStatusPaymentAwaiting {
+		t.Errorf("Invoice.Wait returned status %v, want %v", invoice.Status, InvoiceStatusPaymentAwaiting)
+	}
+
+	const method = "Invoice.Wait"
+	testBadPathParams(t, method, func() error {
+		_, _, err = client.Invoice.Wait(ctx, "\n", nil)
+		return err
+	})
+}
+
+func TestInvoiceService_WaitDeadline(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice/c94c0c95-e735-45ea-982e-a95f7f52ca49", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"id":"c94c0c95-e735-45ea-982e-a95f7f52ca49","status":"PAYMENT_AWAITING"}}`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	opts := &InvoiceWaitOpts{MinInterval: time.Millisecond}
+	invoice, history, err := client.Invoice.Wait(ctx, "c94c0c95-e735-45ea-982e-a95f7f52ca49", opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Invoice.Wait returned error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if invoice == nil || len(history) != 1 {
+		t.Errorf("Invoice.Wait returned %+v and history %+v, want last invoice and one status", invoice, history)
+	}
+}
+
+func TestInvoiceService_WaitEmptyResponse(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var polls int
+	mux.HandleFunc("/v1/invoice/inv", func(w http.ResponseWriter, r *http.Request) {
+		if polls++; polls > 1 {
+			fmt.Fprint(w, `{"data":null}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"id":"inv","status":"PAYMENT_AWAITING"}}`)
+	})
+
+	opts := &InvoiceWaitOpts{MinInterval: time.Millisecond}
+	invoice, history, err := client.Invoice.Wait(context.Background(), "inv", opts)
+	if err == nil || err.Error() != "invoice inv: empty response" {
+		t.Errorf("Invoice.Wait returned error %v, want empty response", err)
+	}
+	if invoice == nil || len(history) != 1 {
+		t.Errorf("Invoice.Wait returned %+v and history %+v, want last invoice and one status", invoice, history)
+	}
+}
+
+func TestInvoiceService_GetOrCreate(t *testing.T) {
+	tests := []struct {
+		title    string
+		invoices string
+		asset    string
+		want     *GetOrCreateInvoiceResponse
+		conflict bool
+	}{
+		{
+			title:    "reuses matching invoice",
+			invoices: `[{"id":"paid","status":"PAID","externalOrderId":"order","invoiceAmount":"100","invoiceAssetCode":"USDT"},{"id":"open","status":"PAYMENT_AWAITING","externalOrderId":"order","invoiceAmount":"100.10","invoiceAssetCode":"USDT"}]`,
+			want: &GetOrCreateInvoiceResponse{ID: "open", Invoice: &Invoice{
+				ID: "open", Status: InvoiceStatusPaymentAwaiting, ExternalOrderID: "order", InvoiceAmount: "100.10", InvoiceAssetCode: "USDT",
+			}},
+		},
+		{
+			title:    "reuses invoice of lower-case asset",
+			invoices: `[{"id":"open","status":"CREATED","externalOrderId":"order","invoiceAmount":"100.1","invoiceAssetCode":"USDT"}]`,
+			asset:    "usdt",
+			want: &GetOrCreateInvoiceResponse{ID: "open", Invoice: &Invoice{
+				ID: "open", Status: InvoiceStatusCreated, ExternalOrderID: "order", InvoiceAmount: "100.1", InvoiceAssetCode: "USDT",
+			}},
+		},
+		{
+			title:    "creates invoice when only terminal invoices match",
+			invoices: `[{"id":"timeout","status":"TIMEOUT","externalOrderId":"order","invoiceAmount":"100.1","invoiceAssetCode":"USDT"}]`,
+			want:     &GetOrCreateInvoiceResponse{ID: "created", PaymentLink: "https://example.com/invoice/created", Created: true},
+		},
+		{
+			title:    "conflicts with different amount",
+			invoices: `[{"id":"open","status":"CREATED","externalOrderId":"order","invoiceAmount":"200","invoiceAssetCode":"USDT"}]`,
+			conflict: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			client, mux, teardown := setupClient()
+			defer teardown()
+
+			mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					testBody(t, r, `{"amount":"100.1","asset":"USDT","externalOrderId":"order"}`+"\n")
+					fmt.Fprint(w, `{"data":{"id":"created","paymentLink":"https://example.com/invoice/created"}}`)
+					return
+				}
+				testMethod(t, r, "GET")
+				testURL(t, r, "/v1/invoice?externalOrderId=order&take=100")
+				fmt.Fprintf(w, `{"data":%s}`, test.invoices)
+			})
+
+			asset := test.asset
+			if asset == "" {
+				asset = "USDT"
+			}
+			got, _, err := client.Invoice.GetOrCreate(context.Background(), &CreateInvoiceRequest{
+				Amount:          "100.1",
+				Asset:           asset,
+				ExternalOrderID: "order",
+			})
+			if test.conflict {
+				var conflictErr *InvoiceConflictError
+				if !errors.As(err, &conflictErr) || conflictErr.Invoice.ID != "open" {
+					t.Errorf("Invoice.GetOrCreate returned error %v, want InvoiceConflictError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Invoice.GetOrCreate returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Invoice.GetOrCreate returned %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInvoiceService_GetOrCreatePaging(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		if r.URL.Query().Get("skip") == "" {
+			invoices := make([]string, invoiceListPageSize)
+			for i := range invoices {
+				invoices[i] = fmt.Sprintf(`{"id":"%d","status":"PAID","externalOrderId":"order"}`, i)
+			}
+			fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(invoices, ","))
+			return
+		}
+		testURL(t, r, "/v1/invoice?externalOrderId=order&skip=100&take=100")
+		fmt.Fprint(w, `{"data":[{"id":"open","status":"CREATED","externalOrderId":"order","invoiceAmount":"1","invoiceAssetCode":"BTC"}]}`)
+	})
+
+	got, _, err := client.Invoice.GetOrCreate(context.Background(), &CreateInvoiceRequest{Amount: "1", Asset: "BTC", ExternalOrderID: "order"})
+	if err != nil {
+		t.Fatalf("Invoice.GetOrCreate returned error: %v", err)
+	}
+	if got.ID != "open" || got.Created {
+		t.Errorf("Invoice.GetOrCreate returned %+v, want reused invoice open", got)
+	}
+
+	if _, _, err := client.Invoice.GetOrCreate(context.Background(), &CreateInvoiceRequest{Amount: "1", Asset: "BTC"}); err == nil {
+		t.Errorf("Invoice.GetOrCreate without external order ID returned nil, want error")
+	}
+}
+
 func invoiceMock() *Invoice {
 	return &Invoice{
 		ID:               "c94c0c95-e735-45ea-982e-a95f7f52ca49",
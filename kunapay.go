@@ -9,9 +9,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -49,6 +51,9 @@ type Client struct {
 	// HTTP client used to communicate with the API.
 	httpClient *http.Client
 
+	// Rate limiter that every API request waits for, if set.
+	limiter RateLimiter
+
 	// Services used for talking to different parts of the KunaPay API.
 	Asset       *AssetService
 	Invoice     *InvoiceService
@@ -147,6 +152,21 @@ func SetBaseURL(apiURL string) ClientOptions {
 	}
 }
 
+// RateLimiter limits the rate of API requests.
+// It is satisfied by *rate.Limiter from golang.org/x/time/rate.
+type RateLimiter interface {
+	// Wait blocks until a request is allowed or the context is done.
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter sets the rate limiter that every API request waits for.
+func WithRateLimiter(limiter RateLimiter) ClientOptions {
+	return func(c *Client) error {
+		c.limiter = limiter
+		return nil
+	}
+}
+
 // NewRequest creates an API request. A relative URL can be provided in the path,
 // it will be resolved in relation to the Client's baseURL. If specified,
 // the value pointed to by body will be JSON encoded and included as the request body.
@@ -206,6 +226,12 @@ func (c *Client) setAuth(req *http.Request, body any) error {
 // The JSON response from the API is decoded and saved in the pointed value v.
 // If there is an API error, an error response is returned instead.
 func (c *Client) Do(req *http.Request, v any) (*Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -280,6 +306,56 @@ func (r *ResponseError) Error() string {
 	)
 }
 
+// FieldError reports an invalid request field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Error returns the string representation of the error.
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// ValidationError reports all invalid fields of a request.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+// Error returns the string representation of the error.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the field errors.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// add records the invalid field.
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Errors = append(e.Errors, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the error if any field is invalid, or nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
+
 // sign calculates the signature for the request using HMAC-SHA384 algorithm.
 func (c *Client) sign(nonce, url string, body any) (string, error) {
 	var reqBody = "{}"
@@ -297,3 +373,119 @@ func (c *Client) sign(nonce, url string, body any) (string, error) {
 
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
+
+// parseDecimal checks the decimal number s, which may have a leading minus
+// sign. It returns the number of significant fractional digits, the number of
+// fractional digits with the trailing zeros and the sign of the number.
+// It reports false if s is not a decimal number.
+func parseDecimal(s string) (places, scale, sign int, ok bool) {
+	whole, frac, hasFrac := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || (hasFrac && frac == "") {
+		return 0, 0, 0, false
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, 0, 0, false
+		}
+		if r != '0' {
+			sign = 1
+		}
+	}
+	if strings.HasPrefix(s, "-") {
+		sign = -sign
+	}
+
+	return len(strings.TrimRight(frac, "0")), len(frac), sign, true
+}
+
+// decimalPlaces returns the number of significant fractional digits
+// of a positive decimal number. It reports false if s is not a positive
+// decimal number.
+func decimalPlaces(s string) (int, bool) {
+	places, _, sign, ok := parseDecimal(s)
+	if !ok || sign <= 0 {
+		return 0, false
+	}
+
+	return places, true
+}
+
+// decimalScale returns the number of fractional digits of the decimal number,
+// trailing zeros included.
+func decimalScale(s string) int {
+	_, scale, _, _ := parseDecimal(s)
+	return scale
+}
+
+// equalDecimals reports whether a and b are the same decimal number,
+// so "100.10" equals "100.1".
+func equalDecimals(a, b string) bool {
+	x, ok := new(big.Rat).SetString(a)
+	if !ok {
+		return false
+	}
+	y, ok := new(big.Rat).SetString(b)
+	if !ok {
+		return false
+	}
+
+	return x.Cmp(y) == 0
+}
+
+// isHTTPSURL reports whether s is an absolute https URL.
+func isHTTPSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// parseTime parses the time returned by the API.
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// forEach calls fn for every index from 0 to n-1 with at most workers calls
+// running concurrently. The first error cancels the context of the other
+// calls and is returned. Otherwise the error of ctx is returned, if any.
+func forEach(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if n < workers {
+		workers = n
+	}
+	jobs := make(chan int)
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(ctx, i); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
@@ -271,6 +271,40 @@ func TestDo_httpBadRequest(t *testing.T) {
 	}
 }
 
+type limiterFunc func(ctx context.Context) error
+
+func (f limiterFunc) Wait(ctx context.Context) error { return f(ctx) }
+
+func TestDo_rateLimiter(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var requests int
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	})
+
+	var waits int
+	limitErr := errors.New("rate limited")
+	client.limiter = limiterFunc(func(ctx context.Context) error {
+		if waits++; waits > 1 {
+			return limitErr
+		}
+		return nil
+	})
+
+	req, _ := client.NewRequest(context.Background(), "GET", ".", nil)
+	if _, err := client.Do(req, nil); err != nil {
+		t.Errorf("Do returned error: %v", err)
+	}
+	if _, err := client.Do(req, nil); !errors.Is(err, limitErr) {
+		t.Errorf("Do returned error %v, want %v", err, limitErr)
+	}
+	if requests != 1 || waits != 2 {
+		t.Errorf("Do sent %d requests after %d waits, want 1 and 2", requests, waits)
+	}
+}
+
 func TestCheckResponse(t *testing.T) {
 	tests := []struct {
 		title    string
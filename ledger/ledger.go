@@ -0,0 +1,262 @@
+// Package ledger turns KunaPay transactions into double-entry bookkeeping.
+//
+// Every processed transaction becomes a journal entry whose postings sum to zero
+// per asset. A posting increases the balance of its account when the amount is
+// positive and decreases it when negative. Money on the KunaPay merchant balance
+// is in the Merchant account, the fees charged by KunaPay go to the Fees account,
+// and the payers and withdrawal recipients are the External account.
+//
+// The postings of the transaction types are:
+//
+//	Deposit:  External -> Merchant, amount
+//	Withdraw: Merchant -> External, amount
+//	Refund:   Merchant -> External, amount
+//	Any fee:  Merchant -> Fees, fee
+//
+// The amount is the processed amount when it is set, so partially processed
+// transactions are booked for what was actually processed. The amount is
+// treated as gross, the fee is booked on top of it.
+package ledger
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vorobeyme/kunapay-go"
+)
+
+// Account is a ledger account.
+type Account string
+
+// The ledger accounts.
+const (
+	Merchant Account = "merchant"
+	Fees     Account = "fees"
+	External Account = "external"
+)
+
+// ErrAlreadyPosted is returned when a transaction is posted twice.
+var ErrAlreadyPosted = errors.New("transaction is already posted")
+
+// Posting is a change of an account balance.
+type Posting struct {
+	Account Account
+	Asset   string
+	Amount  *big.Rat
+
+	// Balance is the running balance of the account after the posting,
+	// set when the entry is posted to a Ledger.
+	Balance *big.Rat
+}
+
+// Entry is a journal entry of a transaction.
+type Entry struct {
+	TransactionID string
+	InvoiceID     string
+	PaymentCode   string
+	Type          kunapay.TransactionType
+	Time          time.Time
+	Postings      []*Posting
+}
+
+// NewEntry returns the journal entry of the transaction, or nil if the
+// transaction is not processed and does not move money.
+func NewEntry(tx *kunapay.Transaction) (*Entry, error) {
+	if !tx.Status.IsSuccessful() {
+		return nil, nil
+	}
+
+	return newEntry(tx)
+}
+
+// newEntry returns the journal entry of the transaction as if it was processed.
+func newEntry(tx *kunapay.Transaction) (*Entry, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, tx.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", tx.ID, err)
+	}
+
+	amountStr := tx.ProcessedAmount
+	if amountStr == "" {
+		amountStr = tx.Amount
+	}
+	amount, err := parseAmount(amountStr)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s amount: %w", tx.ID, err)
+	}
+	fee := new(big.Rat)
+	if tx.Fee != "" {
+		if fee, err = parseAmount(tx.Fee); err != nil {
+			return nil, fmt.Errorf("transaction %s fee: %w", tx.ID, err)
+		}
+	}
+
+	var from, to Account
+	switch tx.Type {
+	case kunapay.TransactionTypeDeposit:
+		from, to = External, Merchant
+	case kunapay.TransactionTypeWithdraw, kunapay.TransactionTypeRefund:
+		from, to = Merchant, External
+	default:
+		return nil, fmt.Errorf("transaction %s has unknown type %q", tx.ID, tx.Type)
+	}
+
+	e := &Entry{
+		TransactionID: tx.ID,
+		InvoiceID:     tx.InvoiceID,
+		PaymentCode:   tx.PaymentCode,
+		Type:          tx.Type,
+		Time:          createdAt,
+	}
+	e.transfer(from, to, tx.Asset, amount)
+	e.transfer(Merchant, Fees, tx.Asset, fee)
+
+	return e, nil
+}
+
+// transfer adds the postings that move the amount between the accounts.
+// The postings are always added in pairs, the source account first.
+func (e *Entry) transfer(from, to Account, asset string, amount *big.Rat) {
+	if amount.Sign() == 0 {
+		return
+	}
+	e.Postings = append(e.Postings,
+		&Posting{Account: from, Asset: asset, Amount: new(big.Rat).Neg(amount)},
+		&Posting{Account: to, Asset: asset, Amount: new(big.Rat).Set(amount)},
+	)
+}
+
+// parseAmount parses a non-negative decimal amount.
+func parseAmount(s string) (*big.Rat, error) {
+	x, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "eE/") {
+		return nil, fmt.Errorf("%q is not a decimal number", s)
+	}
+	if x.Sign() < 0 {
+		return nil, fmt.Errorf("%q is negative", s)
+	}
+
+	return x, nil
+}
+
+// Ledger is a journal of the posted transactions with the running balances
+// of the accounts. It is not safe for concurrent use.
+type Ledger struct {
+	entries  []*Entry
+	posted   map[string]bool
+	balances map[Account]map[string]*big.Rat
+
+	// places is the number of decimal places of the amounts per asset.
+	places map[string]int
+}
+
+// New returns an empty ledger.
+func New() *Ledger {
+	return &Ledger{
+		posted:   make(map[string]bool),
+		balances: make(map[Account]map[string]*big.Rat),
+		places:   make(map[string]int),
+	}
+}
+
+// Post posts the transaction and returns its entry, or nil if the transaction
+// is not processed. Posting a transaction twice returns ErrAlreadyPosted.
+func (l *Ledger) Post(tx *kunapay.Transaction) (*Entry, error) {
+	if l.posted[tx.ID] {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyPosted, tx.ID)
+	}
+
+	e, err := NewEntry(tx)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	for _, s := range []string{tx.Amount, tx.ProcessedAmount, tx.Fee} {
+		if _, frac, ok := strings.Cut(s, "."); ok && len(frac) > l.places[tx.Asset] {
+			l.places[tx.Asset] = len(frac)
+		}
+	}
+
+	for _, p := range e.Postings {
+		if l.balances[p.Account] == nil {
+			l.balances[p.Account] = make(map[string]*big.Rat)
+		}
+		balance := l.balances[p.Account][p.Asset]
+		if balance == nil {
+			balance = new(big.Rat)
+			l.balances[p.Account][p.Asset] = balance
+		}
+		balance.Add(balance, p.Amount)
+		p.Balance = new(big.Rat).Set(balance)
+	}
+	l.posted[tx.ID] = true
+	l.entries = append(l.entries, e)
+
+	return e, nil
+}
+
+// Balance returns the balance of the account in the asset.
+func (l *Ledger) Balance(account Account, asset string) *big.Rat {
+	if balance := l.balances[account][asset]; balance != nil {
+		return new(big.Rat).Set(balance)
+	}
+
+	return new(big.Rat)
+}
+
+// Assets returns the assets of the account with postings, sorted.
+func (l *Ledger) Assets(account Account) []string {
+	var assets []string
+	for asset := range l.balances[account] {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	return assets
+}
+
+// Format formats the amount with the decimal places of the asset amounts.
+func (l *Ledger) Format(asset string, amount *big.Rat) string {
+	return amount.FloatString(l.places[asset])
+}
+
+// Journal returns the entries in the order they were posted.
+func (l *Ledger) Journal() []*Entry {
+	return l.entries
+}
+
+// JournalColumns are the CSV columns written by WriteJournalCSV, in order.
+var JournalColumns = []string{"time", "transactionId", "type", "account", "asset", "amount", "balance"}
+
+// WriteJournalCSV writes the journal as CSV with one row per posting.
+// The balance is the running balance of the account after the posting.
+func (l *Ledger) WriteJournalCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(JournalColumns); err != nil {
+		return err
+	}
+	for _, e := range l.entries {
+		for _, p := range e.Postings {
+			record := []string{
+				e.Time.UTC().Format(time.RFC3339Nano),
+				e.TransactionID,
+				string(e.Type),
+				string(p.Account),
+				p.Asset,
+				l.Format(p.Asset, p.Amount),
+				l.Format(p.Asset, p.Balance),
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,145 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/vorobeyme/kunapay-go"
+)
+
+func rat(s string) *big.Rat {
+	x, _ := new(big.Rat).SetString(s)
+	return x
+}
+
+func TestNewEntry(t *testing.T) {
+	tests := []struct {
+		title string
+		tx    *kunapay.Transaction
+		want  []string
+	}{
+		{
+			title: "deposit with fee",
+			tx:    &kunapay.Transaction{ID: "1", Type: "Deposit", Status: "Processed", Asset: "USDT", Amount: "100", Fee: "1.5", CreatedAt: "2023-07-30T00:00:00.000Z"},
+			want:  []string{"external -100", "merchant 100", "merchant -3/2", "fees 3/2"},
+		},
+		{
+			title: "partially processed deposit",
+			tx:    &kunapay.Transaction{ID: "2", Type: "Deposit", Status: "PartiallyProcessed", Asset: "USDT", Amount: "100", ProcessedAmount: "60", CreatedAt: "2023-07-30T00:00:00.000Z"},
+			want:  []string{"external -60", "merchant 60"},
+		},
+		{
+			title: "withdraw",
+			tx:    &kunapay.Transaction{ID: "3", Type: "Withdraw", Status: "Processed", Asset: "BTC", Amount: "0.5", Fee: "0.0001", CreatedAt: "2023-07-30T00:00:00.000Z"},
+			want:  []string{"merchant -1/2", "external 1/2", "merchant -1/10000", "fees 1/10000"},
+		},
+		{
+			title: "refund",
+			tx:    &kunapay.Transaction{ID: "4", Type: "Refund", Status: "Processed", Asset: "USDT", Amount: "10", Fee: "0", CreatedAt: "2023-07-30T00:00:00.000Z"},
+			want:  []string{"merchant -10", "external 10"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			e, err := NewEntry(test.tx)
+			if err != nil {
+				t.Fatalf("NewEntry returned error: %v", err)
+			}
+			var got []string
+			sum := new(big.Rat)
+			for _, p := range e.Postings {
+				got = append(got, string(p.Account)+" "+p.Amount.RatString())
+				sum.Add(sum, p.Amount)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("NewEntry returned postings %v, want %v", got, test.want)
+			}
+			if sum.Sign() != 0 {
+				t.Errorf("NewEntry postings sum to %s, want 0", sum.RatString())
+			}
+		})
+	}
+}
+
+func TestNewEntry_skipsAndErrors(t *testing.T) {
+	e, err := NewEntry(&kunapay.Transaction{ID: "1", Type: "Deposit", Status: "Processing", Amount: "1"})
+	if e != nil || err != nil {
+		t.Errorf("NewEntry of processing transaction returned %+v, %v, want nil", e, err)
+	}
+
+	for _, tx := range []*kunapay.Transaction{
+		{ID: "1", Type: "Deposit", Status: "Processed", Amount: "1", CreatedAt: "yesterday"},
+		{ID: "1", Type: "Deposit", Status: "Processed", Amount: "1e3", CreatedAt: "2023-07-30T00:00:00Z"},
+		{ID: "1", Type: "Deposit", Status: "Processed", Amount: "-1", CreatedAt: "2023-07-30T00:00:00Z"},
+		{ID: "1", Type: "Deposit", Status: "Processed", Amount: "1", Fee: "x", CreatedAt: "2023-07-30T00:00:00Z"},
+		{ID: "1", Type: "Swap", Status: "Processed", Amount: "1", CreatedAt: "2023-07-30T00:00:00Z"},
+	} {
+		if _, err := NewEntry(tx); err == nil {
+			t.Errorf("NewEntry(%+v) returned nil, want error", tx)
+		}
+	}
+}
+
+func TestLedger(t *testing.T) {
+	l := New()
+	for _, tx := range []*kunapay.Transaction{
+		{ID: "1", Type: "Deposit", Status: "Processed", Asset: "USDT", Amount: "100.00", Fee: "1.00", CreatedAt: "2023-07-30T10:00:00.000Z"},
+		{ID: "2", Type: "Deposit", Status: "Canceled", Asset: "USDT", Amount: "50.00", CreatedAt: "2023-07-30T11:00:00.000Z"},
+		{ID: "3", Type: "Withdraw", Status: "Processed", Asset: "USDT", Amount: "30.5", Fee: "0.5", CreatedAt: "2023-07-30T12:00:00.000Z"},
+		{ID: "4", Type: "Deposit", Status: "Processed", Asset: "BTC", Amount: "0.001", CreatedAt: "2023-07-30T13:00:00.000Z"},
+	} {
+		if _, err := l.Post(tx); err != nil {
+			t.Fatalf("Ledger.Post returned error: %v", err)
+		}
+	}
+
+	if _, err := l.Post(&kunapay.Transaction{ID: "1"}); !errors.Is(err, ErrAlreadyPosted) {
+		t.Errorf("Ledger.Post of posted transaction returned %v, want %v", err, ErrAlreadyPosted)
+	}
+
+	balances := map[Account]string{Merchant: "68.00", Fees: "1.50", External: "-69.50"}
+	for account, want := range balances {
+		if got := l.Format("USDT", l.Balance(account, "USDT")); got != want {
+			t.Errorf("Ledger.Balance(%s, USDT) returned %s, want %s", account, got, want)
+		}
+	}
+	if got := l.Balance(Fees, "BTC"); got.Sign() != 0 {
+		t.Errorf("Ledger.Balance(fees, BTC) returned %s, want 0", got.RatString())
+	}
+	if got, want := l.Assets(Merchant), []string{"BTC", "USDT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Ledger.Assets returned %v, want %v", got, want)
+	}
+	if n := len(l.Journal()); n != 3 {
+		t.Errorf("Ledger.Journal returned %d entries, want 3", n)
+	}
+
+	var buf bytes.Buffer
+	if err := l.WriteJournalCSV(&buf); err != nil {
+		t.Fatalf("Ledger.WriteJournalCSV returned error: %v", err)
+	}
+	want := "time,transactionId,type,account,asset,amount,balance\n" +
+		"2023-07-30T10:00:00Z,1,Deposit,external,USDT,-100.00,-100.00\n" +
+		"2023-07-30T10:00:00Z,1,Deposit,merchant,USDT,100.00,100.00\n" +
+		"2023-07-30T10:00:00Z,1,Deposit,merchant,USDT,-1.00,99.00\n" +
+		"2023-07-30T10:00:00Z,1,Deposit,fees,USDT,1.00,1.00\n" +
+		"2023-07-30T12:00:00Z,3,Withdraw,merchant,USDT,-30.50,68.50\n" +
+		"2023-07-30T12:00:00Z,3,Withdraw,external,USDT,30.50,-69.50\n" +
+		"2023-07-30T12:00:00Z,3,Withdraw,merchant,USDT,-0.50,68.00\n" +
+		"2023-07-30T12:00:00Z,3,Withdraw,fees,USDT,0.50,1.50\n" +
+		"2023-07-30T13:00:00Z,4,Deposit,external,BTC,-0.001,-0.001\n" +
+		"2023-07-30T13:00:00Z,4,Deposit,merchant,BTC,0.001,0.001\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Ledger.WriteJournalCSV wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLedger_Format(t *testing.T) {
+	l := New()
+	if got := l.Format("USDT", rat("1.5")); got != "2" {
+		t.Errorf("Ledger.Format without postings returned %s, want 2", got)
+	}
+}
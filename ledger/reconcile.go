@@ -0,0 +1,295 @@
+package ledger
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vorobeyme/kunapay-go"
+)
+
+// pageSize is the number of transactions requested per page.
+const pageSize = 100
+
+// ReconciliationStatus is the outcome of the reconciliation of an asset.
+type ReconciliationStatus string
+
+// Reconciliation statuses.
+const (
+	// ReconciliationMatched means the KunaPay balance equals the ledger balance.
+	ReconciliationMatched ReconciliationStatus = "matched"
+
+	// ReconciliationPending means the difference equals the net amount of the
+	// transactions that are still processing.
+	ReconciliationPending ReconciliationStatus = "pending"
+
+	// ReconciliationMismatch means the difference is not explained.
+	ReconciliationMismatch ReconciliationStatus = "mismatch"
+)
+
+// AssetReconciliation compares the merchant balance of an asset computed from
+// the transaction history with the balance reported by KunaPay.
+// The amounts are decimal strings.
+type AssetReconciliation struct {
+	Asset  string               `json:"asset"`
+	Status ReconciliationStatus `json:"status"`
+
+	// Balance and LockBalance are the balances reported by KunaPay.
+	Balance     string `json:"balance"`
+	LockBalance string `json:"lockBalance"`
+
+	// Ledger is the Merchant balance computed from the processed transactions.
+	Ledger string `json:"ledger"`
+
+	// Difference is Balance plus LockBalance minus Ledger.
+	Difference string `json:"difference"`
+
+	// Pending is the net amount the processing transactions would add to
+	// the Merchant balance, fees included.
+	Pending string `json:"pending"`
+
+	// Unexplained is the part of the difference that is not explained by the
+	// processing transactions. It is zero unless the status is mismatch.
+	Unexplained string `json:"unexplained"`
+
+	// PendingTransactions are the IDs of the processing transactions.
+	PendingTransactions []string `json:"pendingTransactions"`
+}
+
+// Report is the result of a reconciliation.
+type Report struct {
+	// Time is when the KunaPay balances were read. The transactions created
+	// up to this time are taken into account.
+	Time   time.Time              `json:"time"`
+	Assets []*AssetReconciliation `json:"assets"`
+}
+
+// Discrepancies returns the assets with unexplained differences.
+func (r *Report) Discrepancies() []*AssetReconciliation {
+	var assets []*AssetReconciliation
+	for _, a := range r.Assets {
+		if a.Status == ReconciliationMismatch {
+			assets = append(assets, a)
+		}
+	}
+
+	return assets
+}
+
+// ReportColumns are the CSV columns written by WriteCSV, in order.
+var ReportColumns = []string{"asset", "status", "balance", "lockBalance", "ledger", "difference", "pending", "unexplained", "pendingTransactions"}
+
+// WriteCSV writes the report as CSV with one row per asset.
+// The pending transaction IDs are separated by spaces.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ReportColumns); err != nil {
+		return err
+	}
+	for _, a := range r.Assets {
+		record := []string{
+			a.Asset,
+			string(a.Status),
+			a.Balance,
+			a.LockBalance,
+			a.Ledger,
+			a.Difference,
+			a.Pending,
+			a.Unexplained,
+			strings.Join(a.PendingTransactions, " "),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ReconcileOpts specifies the optional parameters to Reconcile.
+type ReconcileOpts struct {
+	// Assets limits the reconciliation to the assets. By default all assets
+	// with a KunaPay balance or a transaction are reconciled.
+	Assets []string
+}
+
+// Reconcile reads the KunaPay balances, books the whole transaction history
+// created up to that moment and compares the balances per asset.
+//
+// KunaPay does not report historical balances, so the balances are read
+// first and the transactions created later are ignored. A transaction that
+// completes between the two reads can still show up as a mismatch, so
+// flagged assets are worth reconciling again.
+func Reconcile(ctx context.Context, client *kunapay.Client, opts *ReconcileOpts) (*Report, error) {
+	var assets []string
+	if opts != nil {
+		for _, asset := range opts.Assets {
+			if asset = strings.ToUpper(strings.TrimSpace(asset)); asset != "" {
+				assets = append(assets, asset)
+			}
+		}
+	}
+
+	balances, _, err := client.Asset.GetBalance(ctx, assets...)
+	if err != nil {
+		return nil, fmt.Errorf("get balances: %w", err)
+	}
+	now := time.Now().UTC()
+
+	// The default order of the history is not documented, so a transaction
+	// can be listed again on a shifted page. The latest listing wins.
+	var ids []string
+	listed := make(map[string]*kunapay.Transaction)
+	listOpts := &kunapay.TransactionListOpts{Take: pageSize, CreatedTo: &now}
+	for {
+		txs, _, err := client.Transaction.List(ctx, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("list transactions: %w", err)
+		}
+		for _, tx := range txs {
+			if len(assets) > 0 && !contains(assets, tx.Asset) {
+				continue
+			}
+			if _, ok := listed[tx.ID]; !ok {
+				ids = append(ids, tx.ID)
+			}
+			listed[tx.ID] = tx
+		}
+		if len(txs) < pageSize {
+			break
+		}
+		listOpts.Skip += pageSize
+	}
+
+	l := New()
+	pending := make(map[string][]*kunapay.Transaction)
+	for _, id := range ids {
+		tx := listed[id]
+		if tx.Status == kunapay.TransactionStatusProcessing {
+			pending[tx.Asset] = append(pending[tx.Asset], tx)
+			continue
+		}
+		if _, err := l.Post(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{Time: now}
+	seen := make(map[string]bool)
+	for _, b := range balances {
+		a, err := l.reconcile(b.Code, b.Balance, b.LockBalance, pending[b.Code])
+		if err != nil {
+			return nil, err
+		}
+		seen[b.Code] = true
+		report.Assets = append(report.Assets, a)
+	}
+	for _, asset := range unionAssets(l.Assets(Merchant), pending) {
+		if seen[asset] {
+			continue
+		}
+		a, err := l.reconcile(asset, "0", "0", pending[asset])
+		if err != nil {
+			return nil, err
+		}
+		report.Assets = append(report.Assets, a)
+	}
+	sort.Slice(report.Assets, func(i, j int) bool {
+		return report.Assets[i].Asset < report.Assets[j].Asset
+	})
+
+	return report, nil
+}
+
+// reconcile compares the ledger balance of the asset with the KunaPay balances.
+func (l *Ledger) reconcile(asset, balance, lockBalance string, pending []*kunapay.Transaction) (*AssetReconciliation, error) {
+	places := l.places[asset]
+	actual := new(big.Rat)
+	for _, s := range []string{balance, lockBalance} {
+		if s == "" {
+			continue
+		}
+		x, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("asset %s balance %q is not a decimal number", asset, s)
+		}
+		actual.Add(actual, x)
+		if _, frac, ok := strings.Cut(s, "."); ok && len(frac) > places {
+			places = len(frac)
+		}
+	}
+
+	a := &AssetReconciliation{
+		Asset:               asset,
+		Balance:             balance,
+		LockBalance:         lockBalance,
+		PendingTransactions: []string{},
+	}
+	net := new(big.Rat)
+	for _, tx := range pending {
+		e, err := newEntry(tx)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range e.Postings {
+			if p.Account == Merchant {
+				net.Add(net, p.Amount)
+			}
+		}
+		for _, s := range []string{tx.Amount, tx.Fee} {
+			if _, frac, ok := strings.Cut(s, "."); ok && len(frac) > places {
+				places = len(frac)
+			}
+		}
+		a.PendingTransactions = append(a.PendingTransactions, tx.ID)
+	}
+
+	ledger := l.Balance(Merchant, asset)
+	difference := new(big.Rat).Sub(actual, ledger)
+	unexplained := new(big.Rat)
+	switch {
+	case difference.Sign() == 0:
+		a.Status = ReconciliationMatched
+	case difference.Cmp(net) == 0:
+		a.Status = ReconciliationPending
+	default:
+		a.Status = ReconciliationMismatch
+		unexplained.Sub(difference, net)
+	}
+
+	a.Ledger = ledger.FloatString(places)
+	a.Difference = difference.FloatString(places)
+	a.Pending = net.FloatString(places)
+	a.Unexplained = unexplained.FloatString(places)
+
+	return a, nil
+}
+
+// unionAssets returns the sorted assets of the list and the map keys.
+func unionAssets(assets []string, pending map[string][]*kunapay.Transaction) []string {
+	all := append([]string(nil), assets...)
+	for asset := range pending {
+		if !contains(all, asset) {
+			all = append(all, asset)
+		}
+	}
+	sort.Strings(all)
+
+	return all
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
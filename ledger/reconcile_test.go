@@ -0,0 +1,147 @@
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vorobeyme/kunapay-go"
+)
+
+func setupClient(t *testing.T, mux *http.ServeMux) *kunapay.Client {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := kunapay.New("public_key", "private_key", kunapay.SetBaseURL(server.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestReconcile(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/asset/balance", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[
+			{"code":"USDT","balance":"99.00","lockBalance":"9.00"},
+			{"code":"BTC","balance":"0.5","lockBalance":"0"},
+			{"code":"ETH","balance":"2","lockBalance":"0"}
+		]}`)
+	})
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("createdTo") == "" {
+			t.Errorf("Reconcile listed transactions without createdTo")
+		}
+		fmt.Fprint(w, `{"data":[
+			{"id":"1","type":"Deposit","status":"Processed","asset":"USDT","amount":"100.00","fee":"1.00","createdAt":"2023-07-30T10:00:00.000Z"},
+			{"id":"2","type":"Deposit","status":"Processing","asset":"USDT","amount":"10.00","fee":"1.00","createdAt":"2023-07-30T11:00:00.000Z"},
+			{"id":"3","type":"Deposit","status":"Processed","asset":"BTC","amount":"0.7","createdAt":"2023-07-30T12:00:00.000Z"},
+			{"id":"4","type":"Deposit","status":"Processed","asset":"ETH","amount":"2","createdAt":"2023-07-30T12:00:00.000Z"},
+			{"id":"5","type":"Deposit","status":"Processed","asset":"TRX","amount":"5","createdAt":"2023-07-30T13:00:00.000Z"},
+			{"id":"6","type":"Deposit","status":"Canceled","asset":"TRX","amount":"50","createdAt":"2023-07-30T13:00:00.000Z"}
+		]}`)
+	})
+
+	report, err := Reconcile(context.Background(), setupClient(t, mux), nil)
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	var got []string
+	for _, a := range report.Assets {
+		got = append(got, fmt.Sprintf("%s %s ledger=%s diff=%s pending=%s unexplained=%s %v",
+			a.Asset, a.Status, a.Ledger, a.Difference, a.Pending, a.Unexplained, a.PendingTransactions))
+	}
+	want := []string{
+		"BTC mismatch ledger=0.7 diff=-0.2 pending=0.0 unexplained=-0.2 []",
+		"ETH matched ledger=2 diff=0 pending=0 unexplained=0 []",
+		"TRX mismatch ledger=5 diff=-5 pending=0 unexplained=-5 []",
+		"USDT pending ledger=99.00 diff=9.00 pending=9.00 unexplained=0.00 [2]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Reconcile returned\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var discrepancies []string
+	for _, a := range report.Discrepancies() {
+		discrepancies = append(discrepancies, a.Asset)
+	}
+	if want := []string{"BTC", "TRX"}; !reflect.DeepEqual(discrepancies, want) {
+		t.Errorf("Report.Discrepancies returned %v, want %v", discrepancies, want)
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("json.Marshal(report) returned error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("Report.WriteCSV returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[4] != "USDT,pending,99.00,9.00,99.00,9.00,9.00,0.00,2" {
+		t.Errorf("Report.WriteCSV wrote\n%s", buf.String())
+	}
+}
+
+func TestReconcile_assets(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/asset/balance", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("assetCodes"); got != "USDT" {
+			t.Errorf("Reconcile requested balances of %q, want USDT", got)
+		}
+		fmt.Fprint(w, `{"data":[{"code":"USDT","balance":"1","lockBalance":"0"}]}`)
+	})
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[
+			{"id":"1","type":"Deposit","status":"Processed","asset":"USDT","amount":"1","createdAt":"2023-07-30T10:00:00.000Z"},
+			{"id":"2","type":"Deposit","status":"Processed","asset":"BTC","amount":"1","createdAt":"2023-07-30T10:00:00.000Z"}
+		]}`)
+	})
+
+	report, err := Reconcile(context.Background(), setupClient(t, mux), &ReconcileOpts{Assets: []string{" usdt "}})
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if len(report.Assets) != 1 || report.Assets[0].Status != ReconciliationMatched {
+		t.Errorf("Reconcile returned %+v, want USDT matched", report.Assets)
+	}
+}
+
+func TestReconcile_shiftedPage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/asset/balance", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"code":"USDT","balance":"101","lockBalance":"0"}]}`)
+	})
+	// A new transaction shifts the history, so the last transaction of the
+	// first page is listed again on the second one.
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		var txs []string
+		if r.URL.Query().Get("skip") == "" {
+			for i := 1; i <= pageSize; i++ {
+				txs = append(txs, fmt.Sprintf(`{"id":"%d","type":"Deposit","status":"Processed","asset":"USDT","amount":"1","createdAt":"2023-07-30T10:00:00.000Z"}`, i))
+			}
+		} else {
+			txs = append(txs,
+				fmt.Sprintf(`{"id":"%d","type":"Deposit","status":"Processed","asset":"USDT","amount":"1","createdAt":"2023-07-30T10:00:00.000Z"}`, pageSize),
+				fmt.Sprintf(`{"id":"%d","type":"Deposit","status":"Processed","asset":"USDT","amount":"1","createdAt":"2023-07-30T10:00:00.000Z"}`, pageSize+1),
+			)
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(txs, ","))
+	})
+
+	report, err := Reconcile(context.Background(), setupClient(t, mux), nil)
+	if err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+	if len(report.Assets) != 1 || report.Assets[0].Status != ReconciliationMatched || report.Assets[0].Ledger != "101" {
+		t.Errorf("Reconcile returned %+v, want USDT matched at 101", report.Assets)
+	}
+}
@@ -0,0 +1,496 @@
+package ledger
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vorobeyme/kunapay-go"
+)
+
+// Statement is the Merchant account statement of an asset for a period.
+type Statement struct {
+	Asset string
+
+	// From and To are the period of the statement, From inclusive
+	// and To exclusive.
+	From time.Time
+	To   time.Time
+
+	// Opening and Closing are the Merchant balances at From and To.
+	Opening *big.Rat
+	Closing *big.Rat
+
+	// Lines are the statement lines ordered by time.
+	Lines []*StatementLine
+
+	// places is the number of decimal places of the amounts.
+	places int
+}
+
+// StatementLine is a change of the Merchant balance in a statement.
+// A transaction with a fee has two lines, the fee being the second one.
+type StatementLine struct {
+	// ID is unique within the statement: the transaction ID, suffixed
+	// with "-fee" for the fee line.
+	ID string
+
+	TransactionID string
+	InvoiceID     string
+	PaymentCode   string
+	Type          kunapay.TransactionType
+	Time          time.Time
+
+	// Amount is positive for credits and negative for debits.
+	Amount *big.Rat
+
+	// Fee reports whether the line is the fee of the transaction.
+	Fee bool
+}
+
+// Statement returns the Merchant account statement of the asset for the
+// period from inclusive to exclusive. The opening balance is computed from
+// the entries posted before the period, so the ledger must hold the whole
+// transaction history for it to be accurate.
+func (l *Ledger) Statement(asset string, from, to time.Time) *Statement {
+	s := &Statement{
+		Asset:   asset,
+		From:    from,
+		To:      to,
+		Opening: new(big.Rat),
+		Closing: new(big.Rat),
+		places:  l.places[asset],
+	}
+
+	for _, e := range l.entries {
+		if !e.Time.Before(to) {
+			continue
+		}
+		// The postings come in pairs, the source account first.
+		for i := 0; i+1 < len(e.Postings); i += 2 {
+			p, counter := e.Postings[i], e.Postings[i+1]
+			if p.Account != Merchant {
+				p, counter = counter, p
+			}
+			if p.Account != Merchant || p.Asset != asset {
+				continue
+			}
+			if e.Time.Before(from) {
+				s.Opening.Add(s.Opening, p.Amount)
+				continue
+			}
+
+			line := &StatementLine{
+				ID:            e.TransactionID,
+				TransactionID: e.TransactionID,
+				InvoiceID:     e.InvoiceID,
+				PaymentCode:   e.PaymentCode,
+				Type:          e.Type,
+				Time:          e.Time,
+				Amount:        new(big.Rat).Set(p.Amount),
+				Fee:           counter.Account == Fees,
+			}
+			if line.Fee {
+				line.ID += "-fee"
+			}
+			s.Lines = append(s.Lines, line)
+		}
+	}
+	sort.SliceStable(s.Lines, func(i, j int) bool {
+		return s.Lines[i].Time.Before(s.Lines[j].Time)
+	})
+
+	s.Closing.Set(s.Opening)
+	for _, line := range s.Lines {
+		s.Closing.Add(s.Closing, line.Amount)
+	}
+
+	return s
+}
+
+// StatementOpts specifies the optional parameters to the statement writers.
+type StatementOpts struct {
+	// Currency is the ISO 4217 currency code of the statement. Both formats
+	// only accept three-letter codes, so it defaults to the asset code if it
+	// has three letters and to "XXX", the code for no currency, otherwise.
+	Currency string
+
+	// AccountID identifies the account in the statement. Defaults to the asset code.
+	AccountID string
+
+	// CreatedAt is the creation time of the statement. Defaults to now.
+	CreatedAt time.Time
+}
+
+var currencyCodeRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// opts returns the options with the defaults applied.
+func (s *Statement) opts(opts *StatementOpts) StatementOpts {
+	var o StatementOpts
+	if opts != nil {
+		o = *opts
+	}
+	if o.Currency == "" {
+		o.Currency = "XXX"
+		if currencyCodeRegexp.MatchString(s.Asset) {
+			o.Currency = s.Asset
+		}
+	}
+	if o.AccountID == "" {
+		o.AccountID = s.Asset
+	}
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = time.Now()
+	}
+
+	return o
+}
+
+// format formats the amount with the decimal places of the asset.
+func (s *Statement) format(amount *big.Rat) string {
+	return amount.FloatString(s.places)
+}
+
+// camtMaxPlaces is the maximum number of decimal places of camt.053 amounts.
+const camtMaxPlaces = 5
+
+// camtAmount formats the absolute value of the amount for camt.053, which
+// allows at most five decimal places. Amounts that do not fit are an error,
+// since rounding them would make the entries disagree with the balances.
+func (s *Statement) camtAmount(amount *big.Rat) (string, error) {
+	places := s.places
+	if places > camtMaxPlaces {
+		places = camtMaxPlaces
+		scaled := new(big.Rat).Mul(amount, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(camtMaxPlaces), nil)))
+		if !scaled.IsInt() {
+			return "", fmt.Errorf("amount %s of %s has more than %d decimal places, which camt.053 does not allow",
+				s.format(amount), s.Asset, camtMaxPlaces)
+		}
+	}
+
+	return new(big.Rat).Abs(amount).FloatString(places), nil
+}
+
+// memo describes the line with its references.
+func (line *StatementLine) memo() string {
+	memo := string(line.Type)
+	if line.Fee {
+		memo += " fee"
+	}
+	refs := []string{"transaction " + line.TransactionID}
+	if line.InvoiceID != "" {
+		refs = append(refs, "invoice "+line.InvoiceID)
+	}
+	if line.PaymentCode != "" {
+		refs = append(refs, "payment code "+line.PaymentCode)
+	}
+
+	return memo + ", " + strings.Join(refs, ", ")
+}
+
+// OFX 2.2 statement response, limited to the elements the statement uses.
+type ofxDocument struct {
+	XMLName xml.Name `xml:"OFX"`
+	SignOn  struct {
+		Status   ofxStatus `xml:"SONRS>STATUS"`
+		DTServer string    `xml:"SONRS>DTSERVER"`
+		Language string    `xml:"SONRS>LANGUAGE"`
+	} `xml:"SIGNONMSGSRSV1"`
+	Bank struct {
+		TrnUID string    `xml:"STMTTRNRS>TRNUID"`
+		Status ofxStatus `xml:"STMTTRNRS>STATUS"`
+		Stmt   ofxStmtRs `xml:"STMTTRNRS>STMTRS"`
+	} `xml:"BANKMSGSRSV1"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxStmtRs struct {
+	CurDef    string            `xml:"CURDEF"`
+	BankID    string            `xml:"BANKACCTFROM>BANKID"`
+	AcctID    string            `xml:"BANKACCTFROM>ACCTID"`
+	AcctType  string            `xml:"BANKACCTFROM>ACCTTYPE"`
+	DTStart   string            `xml:"BANKTRANLIST>DTSTART"`
+	DTEnd     string            `xml:"BANKTRANLIST>DTEND"`
+	Trans     []*ofxTransaction `xml:"BANKTRANLIST>STMTTRN"`
+	LedgerBal ofxBalance        `xml:"LEDGERBAL"`
+	BalList   []*ofxBal         `xml:"BALLIST>BAL"`
+}
+
+type ofxTransaction struct {
+	TrnType  string `xml:"TRNTYPE"`
+	DTPosted string `xml:"DTPOSTED"`
+	TrnAmt   string `xml:"TRNAMT"`
+	FITID    string `xml:"FITID"`
+	Name     string `xml:"NAME"`
+	Memo     string `xml:"MEMO"`
+}
+
+type ofxBalance struct {
+	BalAmt string `xml:"BALAMT"`
+	DTAsOf string `xml:"DTASOF"`
+}
+
+type ofxBal struct {
+	Name    string `xml:"NAME"`
+	Desc    string `xml:"DESC"`
+	BalType string `xml:"BALTYPE"`
+	Value   string `xml:"VALUE"`
+	DTAsOf  string `xml:"DTASOF"`
+}
+
+// ofxTime formats the time as an OFX datetime in UTC.
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+// ofxMaxAccountID is the maximum length of the OFX account ID.
+const ofxMaxAccountID = 22
+
+// WriteOFX writes the statement as an OFX 2.2 bank statement response.
+// OFX has no opening balance element, so the opening balance is listed
+// in BALLIST, and the closing balance is the LEDGERBAL.
+// The account ID must not be longer than 22 characters.
+func (s *Statement) WriteOFX(w io.Writer, opts *StatementOpts) error {
+	o := s.opts(opts)
+	if len(o.AccountID) > ofxMaxAccountID {
+		return fmt.Errorf("account ID %q is longer than %d characters", o.AccountID, ofxMaxAccountID)
+	}
+
+	doc := &ofxDocument{}
+	doc.SignOn.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	doc.SignOn.DTServer = ofxTime(o.CreatedAt)
+	doc.SignOn.Language = "ENG"
+	doc.Bank.TrnUID = "0"
+	doc.Bank.Status = ofxStatus{Code: 0, Severity: "INFO"}
+	doc.Bank.Stmt = ofxStmtRs{
+		CurDef:    o.Currency,
+		BankID:    "KUNAPAY",
+		AcctID:    o.AccountID,
+		AcctType:  "CHECKING",
+		DTStart:   ofxTime(s.From),
+		DTEnd:     ofxTime(s.To),
+		LedgerBal: ofxBalance{BalAmt: s.format(s.Closing), DTAsOf: ofxTime(s.To)},
+		BalList: []*ofxBal{{
+			Name:    "Opening",
+			Desc:    "Opening balance",
+			BalType: "DOLLAR",
+			Value:   s.format(s.Opening),
+			DTAsOf:  ofxTime(s.From),
+		}},
+	}
+	for _, line := range s.Lines {
+		trnType := "CREDIT"
+		switch {
+		case line.Fee:
+			trnType = "FEE"
+		case line.Amount.Sign() < 0:
+			trnType = "DEBIT"
+		}
+		doc.Bank.Stmt.Trans = append(doc.Bank.Stmt.Trans, &ofxTransaction{
+			TrnType:  trnType,
+			DTPosted: ofxTime(line.Time),
+			TrnAmt:   s.format(line.Amount),
+			FITID:    line.ID,
+			Name:     string(line.Type),
+			Memo:     line.memo(),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header+
+		`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`+"\n"); err != nil {
+		return err
+	}
+
+	return encodeXML(w, doc)
+}
+
+// camt.053.001.02 bank to customer statement, limited to the elements
+// the statement uses.
+type camtDocument struct {
+	XMLName xml.Name `xml:"urn:iso:std:iso:20022:tech:xsd:camt.053.001.02 Document"`
+	MsgID   string   `xml:"BkToCstmrStmt>GrpHdr>MsgId"`
+	CreDtTm string   `xml:"BkToCstmrStmt>GrpHdr>CreDtTm"`
+	Stmt    camtStmt `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStmt struct {
+	ID       string         `xml:"Id"`
+	CreDtTm  string         `xml:"CreDtTm"`
+	FrDtTm   string         `xml:"FrToDt>FrDtTm"`
+	ToDtTm   string         `xml:"FrToDt>ToDtTm"`
+	AcctID   string         `xml:"Acct>Id>Othr>Id"`
+	AcctCcy  string         `xml:"Acct>Ccy"`
+	Balances []*camtBalance `xml:"Bal"`
+	Entries  []*camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Type      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	DtTm      string     `xml:"Dt>DtTm"`
+}
+
+type camtEntry struct {
+	NtryRef      string        `xml:"NtryRef"`
+	Amt          camtAmount    `xml:"Amt"`
+	CdtDbtInd    string        `xml:"CdtDbtInd"`
+	Sts          string        `xml:"Sts"`
+	BookgDtTm    string        `xml:"BookgDt>DtTm"`
+	ValDtTm      string        `xml:"ValDt>DtTm"`
+	AcctSvcrRef  string        `xml:"AcctSvcrRef"`
+	BkTxCd       string        `xml:"BkTxCd>Prtry>Cd"`
+	TxDtls       camtTxDetails `xml:"NtryDtls>TxDtls"`
+	AddtlNtryInf string        `xml:"AddtlNtryInf"`
+}
+
+type camtTxDetails struct {
+	EndToEndID string          `xml:"Refs>EndToEndId"`
+	RmtInf     *camtRemittance `xml:"RmtInf,omitempty"`
+}
+
+type camtRemittance struct {
+	Ustrd string `xml:"Ustrd"`
+}
+
+// camtTime formats the time as an ISO date time in UTC.
+func camtTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// camtRef fits the reference into the 35 characters allowed by camt.053
+// by dropping the dashes of UUIDs and truncating. The full references
+// are kept in the additional entry information.
+func camtRef(ref string) string {
+	if len(ref) > 35 {
+		ref = strings.ReplaceAll(ref, "-", "")
+	}
+	if len(ref) > 35 {
+		ref = ref[:35]
+	}
+
+	return ref
+}
+
+// creditDebit returns the camt.053 credit or debit indicator of the amount.
+func creditDebit(amount *big.Rat) string {
+	if amount.Sign() < 0 {
+		return "DBIT"
+	}
+
+	return "CRDT"
+}
+
+// camtMaxAccountID is the maximum length of the camt.053 account ID.
+const camtMaxAccountID = 34
+
+// WriteCamt053 writes the statement as an ISO 20022 camt.053.001.02 bank to
+// customer statement with the opening (OPBD) and closing (CLBD) balances.
+//
+// The schema limits amounts to five decimal places, so an error is returned
+// if an amount or balance has more, as BTC amounts often do; OFX has no such
+// limit. The account ID must not be longer than 34 characters.
+func (s *Statement) WriteCamt053(w io.Writer, opts *StatementOpts) error {
+	o := s.opts(opts)
+	if len(o.AccountID) > camtMaxAccountID {
+		return fmt.Errorf("account ID %q is longer than %d characters", o.AccountID, camtMaxAccountID)
+	}
+	opening, err := s.camtAmount(s.Opening)
+	if err != nil {
+		return err
+	}
+	closing, err := s.camtAmount(s.Closing)
+	if err != nil {
+		return err
+	}
+
+	id := camtRef(fmt.Sprintf("%s-%s-%s", o.AccountID, s.From.UTC().Format("20060102"), s.To.UTC().Format("20060102")))
+	doc := &camtDocument{
+		MsgID:   id,
+		CreDtTm: camtTime(o.CreatedAt),
+		Stmt: camtStmt{
+			ID:      id,
+			CreDtTm: camtTime(o.CreatedAt),
+			FrDtTm:  camtTime(s.From),
+			ToDtTm:  camtTime(s.To),
+			AcctID:  o.AccountID,
+			AcctCcy: o.Currency,
+			Balances: []*camtBalance{
+				{
+					Type:      "OPBD",
+					Amt:       camtAmount{Ccy: o.Currency, Value: opening},
+					CdtDbtInd: creditDebit(s.Opening),
+					DtTm:      camtTime(s.From),
+				},
+				{
+					Type:      "CLBD",
+					Amt:       camtAmount{Ccy: o.Currency, Value: closing},
+					CdtDbtInd: creditDebit(s.Closing),
+					DtTm:      camtTime(s.To),
+				},
+			},
+		},
+	}
+	for _, line := range s.Lines {
+		code := string(line.Type)
+		if line.Fee {
+			code = "Fee"
+		}
+		endToEndID := "NOTPROVIDED"
+		if line.InvoiceID != "" {
+			endToEndID = camtRef(line.InvoiceID)
+		}
+		amount, err := s.camtAmount(line.Amount)
+		if err != nil {
+			return fmt.Errorf("entry %s: %w", line.ID, err)
+		}
+		details := camtTxDetails{EndToEndID: endToEndID}
+		if line.PaymentCode != "" {
+			details.RmtInf = &camtRemittance{Ustrd: line.PaymentCode}
+		}
+		doc.Stmt.Entries = append(doc.Stmt.Entries, &camtEntry{
+			NtryRef:      camtRef(line.ID),
+			Amt:          camtAmount{Ccy: o.Currency, Value: amount},
+			CdtDbtInd:    creditDebit(line.Amount),
+			Sts:          "BOOK",
+			BookgDtTm:    camtTime(line.Time),
+			ValDtTm:      camtTime(line.Time),
+			AcctSvcrRef:  camtRef(line.TransactionID),
+			BkTxCd:       code,
+			TxDtls:       details,
+			AddtlNtryInf: line.memo(),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return encodeXML(w, doc)
+}
+
+// encodeXML writes the document as indented XML followed by a newline.
+func encodeXML(w io.Writer, doc any) error {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
@@ -0,0 +1,319 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vorobeyme/kunapay-go"
+)
+
+// xmlNode is a generic XML element used to check the document structure.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []*xmlNode `xml:",any"`
+}
+
+// find returns the first descendant at the path of element names.
+func (n *xmlNode) find(path ...string) *xmlNode {
+	if len(path) == 0 {
+		return n
+	}
+	for _, c := range n.Children {
+		if c.XMLName.Local == path[0] {
+			return c.find(path[1:]...)
+		}
+	}
+
+	return nil
+}
+
+// all returns the children with the name.
+func (n *xmlNode) all(name string) []*xmlNode {
+	var nodes []*xmlNode
+	for _, c := range n.Children {
+		if c.XMLName.Local == name {
+			nodes = append(nodes, c)
+		}
+	}
+
+	return nodes
+}
+
+// names returns the names of the children in order.
+func (n *xmlNode) names() []string {
+	var names []string
+	for _, c := range n.Children {
+		names = append(names, c.XMLName.Local)
+	}
+
+	return names
+}
+
+// text returns the trimmed content of the descendant at the path.
+func (n *xmlNode) text(path ...string) string {
+	if d := n.find(path...); d != nil {
+		return strings.TrimSpace(d.Content)
+	}
+
+	return ""
+}
+
+func parseXML(t *testing.T, data []byte) *xmlNode {
+	t.Helper()
+	root := &xmlNode{}
+	if err := xml.Unmarshal(data, root); err != nil {
+		t.Fatalf("xml.Unmarshal returned error: %v\n%s", err, data)
+	}
+
+	return root
+}
+
+// validateXML validates the document against the published schema in
+// testdata with xmllint. The test is skipped if xmllint is not installed or
+// the schema is not in testdata, see testdata/README.md.
+func validateXML(t *testing.T, schema string, data []byte) {
+	t.Helper()
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+	path := filepath.Join("testdata", schema)
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s is not in testdata", schema)
+	}
+
+	cmd := exec.Command(xmllint, "--noout", "--schema", path, "-")
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("document does not validate against %s: %v\n%s\n%s", schema, err, out, data)
+	}
+}
+
+// ofxNamespace puts the OFX root element in the namespace the OFX 2.2 schemas
+// declare it in. OFX files leave it out, so the schemas can't validate them as is.
+func ofxNamespace(data []byte) []byte {
+	data = bytes.Replace(data, []byte("<OFX>"), []byte(`<ofx:OFX xmlns:ofx="http://ofx.net/types/2003/04">`), 1)
+	return bytes.Replace(data, []byte("</OFX>"), []byte("</ofx:OFX>"), 1)
+}
+
+func testStatement(t *testing.T) *Statement {
+	l := New()
+	for _, tx := range []*kunapay.Transaction{
+		{ID: "1", Type: "Deposit", Status: "Processed", Asset: "USD", Amount: "100.00", Fee: "1.00", CreatedAt: "2023-06-30T10:00:00.000Z"},
+		{ID: "2", Type: "Deposit", Status: "Processed", Asset: "USD", Amount: "50.00", Fee: "0.50", InvoiceID: "inv", PaymentCode: "USD", CreatedAt: "2023-07-02T10:00:00.000Z"},
+		{ID: "3", Type: "Withdraw", Status: "Processed", Asset: "USD", Amount: "20.00", Fee: "1.00", CreatedAt: "2023-07-01T10:00:00.000Z"},
+		{ID: "4", Type: "Deposit", Status: "Processed", Asset: "BTC", Amount: "1", CreatedAt: "2023-07-01T10:00:00.000Z"},
+		{ID: "5", Type: "Deposit", Status: "Processed", Asset: "USD", Amount: "10.00", CreatedAt: "2023-08-01T00:00:00.000Z"},
+	} {
+		if _, err := l.Post(tx); err != nil {
+			t.Fatalf("Ledger.Post returned error: %v", err)
+		}
+	}
+
+	return l.Statement("USD", time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func TestLedger_Statement(t *testing.T) {
+	s := testStatement(t)
+
+	if got := s.format(s.Opening); got != "99.00" {
+		t.Errorf("Statement.Opening is %s, want 99.00", got)
+	}
+	if got := s.format(s.Closing); got != "127.50" {
+		t.Errorf("Statement.Closing is %s, want 127.50", got)
+	}
+
+	var got []string
+	for _, line := range s.Lines {
+		got = append(got, line.ID+" "+s.format(line.Amount))
+	}
+	want := []string{"3 -20.00", "3-fee -1.00", "2 50.00", "2-fee -0.50"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Statement.Lines are %v, want %v", got, want)
+	}
+}
+
+func TestStatement_WriteOFX(t *testing.T) {
+	s := testStatement(t)
+
+	var buf bytes.Buffer
+	err := s.WriteOFX(&buf, &StatementOpts{CreatedAt: time.Date(2023, 8, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Statement.WriteOFX returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `<?OFX OFXHEADER="200" VERSION="220"`) {
+		t.Errorf("Statement.WriteOFX wrote no OFX header:\n%s", buf.String())
+	}
+
+	root := parseXML(t, buf.Bytes())
+	if got, want := root.find("SIGNONMSGSRSV1", "SONRS").names(), []string{"STATUS", "DTSERVER", "LANGUAGE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SONRS has elements %v, want %v", got, want)
+	}
+	stmt := root.find("BANKMSGSRSV1", "STMTTRNRS", "STMTRS")
+	if got, want := stmt.names(), []string{"CURDEF", "BANKACCTFROM", "BANKTRANLIST", "LEDGERBAL", "BALLIST"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("STMTRS has elements %v, want %v", got, want)
+	}
+	if got := stmt.text("CURDEF"); got != "USD" {
+		t.Errorf("CURDEF is %s, want USD", got)
+	}
+	if got := stmt.text("LEDGERBAL", "BALAMT"); got != "127.50" {
+		t.Errorf("LEDGERBAL is %s, want 127.50", got)
+	}
+	if got := stmt.text("BALLIST", "BAL", "VALUE"); got != "99.00" {
+		t.Errorf("opening BAL is %s, want 99.00", got)
+	}
+	if got := stmt.text("BANKTRANLIST", "DTSTART"); got != "20230701000000.000[0:GMT]" {
+		t.Errorf("DTSTART is %s", got)
+	}
+
+	var trans []string
+	for _, tr := range stmt.find("BANKTRANLIST").all("STMTTRN") {
+		if got, want := tr.names(), []string{"TRNTYPE", "DTPOSTED", "TRNAMT", "FITID", "NAME", "MEMO"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("STMTTRN has elements %v, want %v", got, want)
+		}
+		trans = append(trans, tr.text("TRNTYPE")+" "+tr.text("TRNAMT")+" "+tr.text("FITID"))
+	}
+	want := []string{"DEBIT -20.00 3", "FEE -1.00 3-fee", "CREDIT 50.00 2", "FEE -0.50 2-fee"}
+	if !reflect.DeepEqual(trans, want) {
+		t.Errorf("STMTTRN are %v, want %v", trans, want)
+	}
+	if got, want := stmt.find("BANKTRANLIST").all("STMTTRN")[2].text("MEMO"), "Deposit, transaction 2, invoice inv, payment code USD"; got != want {
+		t.Errorf("MEMO is %q, want %q", got, want)
+	}
+}
+
+func TestStatement_WriteCamt053(t *testing.T) {
+	s := testStatement(t)
+
+	var buf bytes.Buffer
+	err := s.WriteCamt053(&buf, &StatementOpts{AccountID: "merchant-usd", CreatedAt: time.Date(2023, 8, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Statement.WriteCamt053 returned error: %v", err)
+	}
+
+	root := parseXML(t, buf.Bytes())
+	if root.XMLName.Space != "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02" || root.XMLName.Local != "Document" {
+		t.Errorf("root element is %v", root.XMLName)
+	}
+	if got, want := root.find("BkToCstmrStmt").names(), []string{"GrpHdr", "Stmt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BkToCstmrStmt has elements %v, want %v", got, want)
+	}
+	stmt := root.find("BkToCstmrStmt", "Stmt")
+	if got, want := stmt.names(), []string{"Id", "CreDtTm", "FrToDt", "Acct", "Bal", "Bal", "Ntry", "Ntry", "Ntry", "Ntry"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stmt has elements %v, want %v", got, want)
+	}
+	if got := stmt.text("Acct", "Id", "Othr", "Id"); got != "merchant-usd" {
+		t.Errorf("Acct Id is %s, want merchant-usd", got)
+	}
+	if got := stmt.text("Id"); len(got) > 35 {
+		t.Errorf("Stmt Id %q is longer than 35 characters", got)
+	}
+
+	var balances []string
+	for _, b := range stmt.all("Bal") {
+		balances = append(balances, b.text("Tp", "CdOrPrtry", "Cd")+" "+b.text("Amt")+" "+b.text("CdtDbtInd"))
+	}
+	if want := []string{"OPBD 99.00 CRDT", "CLBD 127.50 CRDT"}; !reflect.DeepEqual(balances, want) {
+		t.Errorf("Bal are %v, want %v", balances, want)
+	}
+
+	var entries []string
+	for _, e := range stmt.all("Ntry") {
+		got := e.names()
+		want := []string{"NtryRef", "Amt", "CdtDbtInd", "Sts", "BookgDt", "ValDt", "AcctSvcrRef", "BkTxCd", "NtryDtls", "AddtlNtryInf"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Ntry has elements %v, want %v", got, want)
+		}
+		if ccy := e.find("Amt").Attrs; len(ccy) != 1 || ccy[0].Value != "USD" {
+			t.Errorf("Ntry Amt has attributes %v, want Ccy USD", ccy)
+		}
+		entries = append(entries, e.text("NtryRef")+" "+e.text("Amt")+" "+e.text("CdtDbtInd")+" "+e.text("BkTxCd", "Prtry", "Cd")+" "+e.text("NtryDtls", "TxDtls", "Refs", "EndToEndId"))
+	}
+	want := []string{
+		"3 20.00 DBIT Withdraw NOTPROVIDED",
+		"3-fee 1.00 DBIT Fee NOTPROVIDED",
+		"2 50.00 CRDT Deposit inv",
+		"2-fee 0.50 DBIT Fee inv",
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Ntry are %v, want %v", entries, want)
+	}
+}
+
+func TestStatement_schemas(t *testing.T) {
+	opts := &StatementOpts{CreatedAt: time.Date(2023, 8, 2, 0, 0, 0, 0, time.UTC)}
+
+	t.Run("OFX", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := testStatement(t).WriteOFX(&buf, opts); err != nil {
+			t.Fatalf("Statement.WriteOFX returned error: %v", err)
+		}
+		validateXML(t, "OFX2_Protocol.xsd", ofxNamespace(buf.Bytes()))
+	})
+	t.Run("camt.053", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := testStatement(t).WriteCamt053(&buf, opts); err != nil {
+			t.Fatalf("Statement.WriteCamt053 returned error: %v", err)
+		}
+		validateXML(t, "camt.053.001.02.xsd", buf.Bytes())
+	})
+}
+
+func TestStatement_WriteCamt053Precision(t *testing.T) {
+	l := New()
+	for _, tx := range []*kunapay.Transaction{
+		{ID: "1", Type: "Deposit", Status: "Processed", Asset: "BTC", Amount: "1.00000000", Fee: "0.00010000", CreatedAt: "2023-07-01T10:00:00.000Z"},
+		{ID: "2", Type: "Deposit", Status: "Processed", Asset: "BTC", Amount: "0.00012345", CreatedAt: "2023-07-02T10:00:00.000Z"},
+	} {
+		if _, err := l.Post(tx); err != nil {
+			t.Fatalf("Ledger.Post returned error: %v", err)
+		}
+	}
+	from := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	// Eight decimal amounts that fit five decimal places are shortened.
+	var buf bytes.Buffer
+	if err := l.Statement("BTC", from, from.Add(24*time.Hour)).WriteCamt053(&buf, nil); err != nil {
+		t.Fatalf("Statement.WriteCamt053 returned error: %v", err)
+	}
+	stmt := parseXML(t, buf.Bytes()).find("BkToCstmrStmt", "Stmt")
+	if got := stmt.all("Ntry")[0].text("Amt"); got != "1.00000" {
+		t.Errorf("Ntry Amt is %s, want 1.00000", got)
+	}
+
+	// The others are an error rather than rounded.
+	var rejected bytes.Buffer
+	err := l.Statement("BTC", from, from.Add(48*time.Hour)).WriteCamt053(&rejected, nil)
+	if err == nil || !strings.Contains(err.Error(), "more than 5 decimal places") {
+		t.Errorf("Statement.WriteCamt053 returned error %v, want precision error", err)
+	}
+
+	validateXML(t, "camt.053.001.02.xsd", buf.Bytes())
+}
+
+func TestStatementOpts(t *testing.T) {
+	s := &Statement{Asset: "USDT"}
+	if o := s.opts(nil); o.Currency != "XXX" || o.AccountID != "USDT" || o.CreatedAt.IsZero() {
+		t.Errorf("Statement.opts returned %+v", o)
+	}
+	if got := camtRef("0b7b0e5e-5d4c-4f1b-9f3a-7c1e2d3f4a5b"); got != "0b7b0e5e5d4c4f1b9f3a7c1e2d3f4a5b" {
+		t.Errorf("camtRef returned %s", got)
+	}
+
+	long := &StatementOpts{AccountID: strings.Repeat("x", 35)}
+	if err := s.WriteOFX(&bytes.Buffer{}, long); err == nil {
+		t.Errorf("Statement.WriteOFX with long account ID returned nil, want error")
+	}
+	if err := s.WriteCamt053(&bytes.Buffer{}, long); err == nil {
+		t.Errorf("Statement.WriteCamt053 with long account ID returned nil, want error")
+	}
+}
@@ -0,0 +1,340 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// convertedPlaces is the number of decimal places of the amounts
+// converted between the payment and invoice assets.
+const convertedPlaces = 8
+
+// PaymentAmounts is an amount in both the invoice and payment assets.
+type PaymentAmounts struct {
+	Invoice string
+	Payment string
+}
+
+// PaymentBalance is the payment state of an invoice, computed from its transactions.
+// The amounts converted between the assets use the rate of the invoice, i.e.
+// InvoiceAmount / PaymentAmount, and are rounded to 8 decimal places.
+type PaymentBalance struct {
+	InvoiceAsset string
+	PaymentAsset string
+
+	Expected    PaymentAmounts
+	Paid        PaymentAmounts
+	Outstanding PaymentAmounts
+	Overpaid    PaymentAmounts
+
+	// paid, outstanding and overpaid amounts in the invoice asset, not rounded.
+	paid        *big.Rat
+	outstanding *big.Rat
+	overpaid    *big.Rat
+}
+
+// NewPaymentBalance computes the paid, outstanding and overpaid amounts of the
+// invoice. The paid amount is the sum of the deposits minus the sum of the
+// refunds, counting only the processed and partially processed transactions,
+// with their processed amount if it is set. Other transaction types are ignored.
+func NewPaymentBalance(detail *InvoiceDetail) (*PaymentBalance, error) {
+	expected, ok := new(big.Rat).SetString(detail.InvoiceAmount)
+	if !ok || expected.Sign() <= 0 {
+		return nil, fmt.Errorf("invoice %s amount %q is not a positive decimal number", detail.ID, detail.InvoiceAmount)
+	}
+
+	paymentAsset := detail.PaymentAssetCode
+	if paymentAsset == "" {
+		paymentAsset = detail.InvoiceAssetCode
+	}
+
+	// rate converts the payment asset to the invoice asset.
+	rate := big.NewRat(1, 1)
+	if paymentAsset != detail.InvoiceAssetCode {
+		payment, ok := new(big.Rat).SetString(detail.PaymentAmount)
+		if !ok || payment.Sign() <= 0 {
+			return nil, fmt.Errorf("invoice %s payment amount %q is not a positive decimal number", detail.ID, detail.PaymentAmount)
+		}
+		rate.Quo(expected, payment)
+	}
+
+	places := 0
+	paid := new(big.Rat)
+	for _, tx := range detail.Transactions {
+		refund := tx.Type == TransactionTypeRefund
+		if (tx.Type != TransactionTypeDeposit && !refund) || !tx.Status.IsSuccessful() {
+			continue
+		}
+		if tx.Asset != "" && tx.Asset != paymentAsset {
+			return nil, fmt.Errorf("transaction %s asset is %s, want %s", tx.ID, tx.Asset, paymentAsset)
+		}
+		amount := tx.ProcessedAmount
+		if amount == "" {
+			amount = tx.Amount
+		}
+		x, ok := new(big.Rat).SetString(amount)
+		if !ok {
+			return nil, fmt.Errorf("transaction %s amount %q is not a decimal number", tx.ID, amount)
+		}
+		if refund {
+			x.Neg(x)
+		}
+		paid.Add(paid, x)
+		if n := decimalScale(amount); n > places {
+			places = n
+		}
+	}
+
+	paidInvoice := new(big.Rat).Mul(paid, rate)
+	diff := new(big.Rat).Sub(expected, paidInvoice)
+
+	b := &PaymentBalance{
+		InvoiceAsset: detail.InvoiceAssetCode,
+		PaymentAsset: paymentAsset,
+		paid:         paidInvoice,
+		outstanding:  new(big.Rat),
+		overpaid:     new(big.Rat),
+	}
+	if diff.Sign() > 0 {
+		b.outstanding.Set(diff)
+	} else {
+		b.overpaid.Neg(diff)
+	}
+
+	invoiceAmounts := func(x *big.Rat) PaymentAmounts {
+		return PaymentAmounts{
+			Invoice: formatDecimal(x, convertedPlaces),
+			Payment: formatDecimal(new(big.Rat).Quo(x, rate), convertedPlaces),
+		}
+	}
+	b.Expected = PaymentAmounts{Invoice: detail.InvoiceAmount, Payment: detail.PaymentAmount}
+	if paymentAsset == detail.InvoiceAssetCode {
+		b.Expected.Payment = detail.InvoiceAmount
+	}
+	b.Paid = PaymentAmounts{Invoice: formatDecimal(paidInvoice, convertedPlaces), Payment: formatDecimal(paid, places)}
+	b.Outstanding = invoiceAmounts(b.outstanding)
+	b.Overpaid = invoiceAmounts(b.overpaid)
+
+	return b, nil
+}
+
+// formatDecimal formats x rounded to the decimal places, without trailing zeros.
+func formatDecimal(x *big.Rat, places int) string {
+	s := x.FloatString(places)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	return s
+}
+
+// PartialPaymentAction is the follow-up action for a partially paid invoice.
+type PartialPaymentAction int
+
+// The follow-up actions for a partially paid invoice.
+const (
+	// PartialPaymentAccept accepts the invoice as paid, the difference
+	// is within the tolerance.
+	PartialPaymentAccept PartialPaymentAction = iota
+
+	// PartialPaymentTopUp asks for the outstanding amount with a top-up invoice.
+	PartialPaymentTopUp
+
+	// PartialPaymentRefund returns the overpaid amount to the payer.
+	PartialPaymentRefund
+)
+
+// String returns the name of the action.
+func (a PartialPaymentAction) String() string {
+	switch a {
+	case PartialPaymentAccept:
+		return "accept"
+	case PartialPaymentTopUp:
+		return "top-up"
+	case PartialPaymentRefund:
+		return "refund"
+	}
+
+	return fmt.Sprintf("PartialPaymentAction(%d)", int(a))
+}
+
+// PartialPaymentPolicy specifies how partially paid and overpaid invoices are resolved.
+type PartialPaymentPolicy struct {
+	// Tolerance is the difference in the invoice asset, underpaid or
+	// overpaid, that is accepted. Defaults to zero.
+	Tolerance string
+
+	// CreateTopUp creates the top-up invoice for the outstanding amount,
+	// otherwise it is only suggested.
+	CreateTopUp bool
+
+	// Precision is the number of decimal places of the top-up invoice amount,
+	// which is rounded up. If nil, it defaults to the precision of the invoice amount.
+	Precision *int
+}
+
+// PartialPaymentResolution is the suggested or performed follow-up action.
+type PartialPaymentResolution struct {
+	Balance *PaymentBalance
+	Action  PartialPaymentAction
+
+	// TopUp is the request of the top-up invoice for the PartialPaymentTopUp
+	// action. It is nil if a top-up invoice is still open.
+	TopUp *CreateInvoiceRequest
+
+	// TopUpInvoice is the top-up invoice that is still open, or the one the
+	// policy creates.
+	TopUpInvoice *GetOrCreateInvoiceResponse
+
+	// TopUpPaid is the amount in the invoice asset paid by the earlier
+	// top-up invoices of the invoice, which reduces the outstanding amount.
+	TopUpPaid string
+
+	// Refund is the amount to return for the PartialPaymentRefund action.
+	Refund PaymentAmounts
+}
+
+// ResolvePartialPayment computes the payment balance of the invoice and
+// chooses the follow-up action with the policy.
+//
+// The top-up invoices have the external order ID of the invoice with a "-topup"
+// suffix, or the invoice ID if it has none. If the invoice is underpaid, the
+// payments of its top-up invoices are counted as well, so a paid top-up
+// resolves the invoice. While a top-up invoice is open, it is the resolution,
+// even if it is partially paid or its amount differs from the outstanding
+// amount; a new top-up invoice is requested only for what is left once the
+// earlier ones are paid or expired. Refunds are only proposed.
+func (s *InvoiceService) ResolvePartialPayment(ctx context.Context, detail *InvoiceDetail, policy *PartialPaymentPolicy) (*PartialPaymentResolution, error) {
+	var p PartialPaymentPolicy
+	if policy != nil {
+		p = *policy
+	}
+
+	tolerance := new(big.Rat)
+	if p.Tolerance != "" {
+		if _, ok := tolerance.SetString(p.Tolerance); !ok || tolerance.Sign() < 0 {
+			return nil, fmt.Errorf("tolerance %q is not a decimal number", p.Tolerance)
+		}
+	}
+
+	balance, err := NewPaymentBalance(detail)
+	if err != nil {
+		return nil, err
+	}
+	r := &PartialPaymentResolution{Balance: balance, Action: PartialPaymentAccept}
+
+	outstanding := balance.outstanding
+	if outstanding.Cmp(tolerance) > 0 {
+		topUpPaid, open, err := s.topUps(ctx, detail)
+		if err != nil {
+			return nil, err
+		}
+		r.TopUpPaid = formatDecimal(topUpPaid, convertedPlaces)
+		outstanding = new(big.Rat).Sub(outstanding, topUpPaid)
+
+		// Another top-up invoice would conflict with the open one.
+		if open != nil && outstanding.Cmp(tolerance) > 0 {
+			r.Action = PartialPaymentTopUp
+			r.TopUpInvoice = &GetOrCreateInvoiceResponse{ID: open.ID, Invoice: open}
+			return r, nil
+		}
+	}
+
+	switch {
+	case outstanding.Cmp(tolerance) > 0:
+		r.Action = PartialPaymentTopUp
+		r.TopUp = topUpRequest(detail, outstanding, p.Precision)
+	case balance.overpaid.Cmp(tolerance) > 0:
+		r.Action = PartialPaymentRefund
+		r.Refund = balance.Overpaid
+		return r, nil
+	default:
+		return r, nil
+	}
+
+	if p.CreateTopUp {
+		r.TopUpInvoice, _, err = s.GetOrCreate(ctx, r.TopUp)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// topUpOrderID returns the external order ID of the top-up invoices of the invoice.
+func topUpOrderID(detail *InvoiceDetail) string {
+	orderID := detail.ExternalOrderID
+	if orderID == "" {
+		orderID = detail.ID
+	}
+
+	return orderID + "-topup"
+}
+
+// topUps returns the amount in the invoice asset paid by the top-up invoices
+// of the invoice, and the first of them that is not in a terminal status.
+func (s *InvoiceService) topUps(ctx context.Context, detail *InvoiceDetail) (*big.Rat, *Invoice, error) {
+	orderID := topUpOrderID(detail)
+	paid := new(big.Rat)
+	var open *Invoice
+	opts := &InvoiceListOpts{Take: invoiceListPageSize, ExternalOrderID: orderID}
+	for {
+		invoices, _, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, invoice := range invoices {
+			if invoice.ExternalOrderID != orderID || invoice.InvoiceAssetCode != detail.InvoiceAssetCode {
+				continue
+			}
+			if open == nil && !invoice.Status.IsTerminal() {
+				open = invoice
+			}
+			topUp, _, err := s.Get(ctx, invoice.ID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("get top-up invoice %s: %w", invoice.ID, err)
+			}
+			if topUp == nil {
+				return nil, nil, fmt.Errorf("get top-up invoice %s: empty response", invoice.ID)
+			}
+			balance, err := NewPaymentBalance(topUp)
+			if err != nil {
+				return nil, nil, err
+			}
+			paid.Add(paid, balance.paid)
+		}
+		if len(invoices) < invoiceListPageSize {
+			return paid, open, nil
+		}
+		opts.Skip += invoiceListPageSize
+	}
+}
+
+// topUpRequest returns the request of the invoice for the outstanding amount.
+// If precision is nil, the precision of the invoice amount is used.
+func topUpRequest(detail *InvoiceDetail, outstanding *big.Rat, precision *int) *CreateInvoiceRequest {
+	places := decimalScale(detail.InvoiceAmount)
+	if precision != nil {
+		places = *precision
+	}
+
+	// Round up, so the top-up covers the whole outstanding amount.
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	units := new(big.Int).Mul(outstanding.Num(), scale)
+	units, rem := units.QuoRem(units, outstanding.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		units.Add(units, big.NewInt(1))
+	}
+	amount := new(big.Rat).SetFrac(units, scale)
+
+	return &CreateInvoiceRequest{
+		Amount:             formatDecimal(amount, places),
+		Asset:              detail.InvoiceAssetCode,
+		ExternalOrderID:    topUpOrderID(detail),
+		ProductDescription: detail.ProductDescription,
+		ProductCategory:    detail.ProductCategory,
+	}
+}
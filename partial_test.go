@@ -0,0 +1,230 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewPaymentBalance(t *testing.T) {
+	tests := []struct {
+		title  string
+		detail *InvoiceDetail
+		want   PaymentBalance
+	}{
+		{
+			title: "partially paid",
+			detail: &InvoiceDetail{
+				InvoiceAmount: "100", InvoiceAssetCode: "USDT", PaymentAmount: "0.004", PaymentAssetCode: "BTC",
+				Transactions: []InvoiceTransaction{
+					{ID: "1", Type: "Deposit", Asset: "BTC", Amount: "0.001", Status: TransactionStatusProcessed},
+					{ID: "2", Type: "Deposit", Asset: "BTC", Amount: "0.0015", ProcessedAmount: "0.0014", Status: TransactionStatusPartiallyProcessed},
+					{ID: "3", Type: "Deposit", Asset: "BTC", Amount: "1", Status: TransactionStatusCanceled},
+				},
+			},
+			want: PaymentBalance{
+				InvoiceAsset: "USDT", PaymentAsset: "BTC",
+				Expected:    PaymentAmounts{Invoice: "100", Payment: "0.004"},
+				Paid:        PaymentAmounts{Invoice: "60", Payment: "0.0024"},
+				Outstanding: PaymentAmounts{Invoice: "40", Payment: "0.0016"},
+				Overpaid:    PaymentAmounts{Invoice: "0", Payment: "0"},
+			},
+		},
+		{
+			title: "overpaid in the same asset",
+			detail: &InvoiceDetail{
+				InvoiceAmount: "10.5", InvoiceAssetCode: "USDT", PaymentAssetCode: "USDT",
+				Transactions: []InvoiceTransaction{{ID: "1", Type: "Deposit", Asset: "USDT", Amount: "12", Status: TransactionStatusProcessed}},
+			},
+			want: PaymentBalance{
+				InvoiceAsset: "USDT", PaymentAsset: "USDT",
+				Expected:    PaymentAmounts{Invoice: "10.5", Payment: "10.5"},
+				Paid:        PaymentAmounts{Invoice: "12", Payment: "12"},
+				Outstanding: PaymentAmounts{Invoice: "0", Payment: "0"},
+				Overpaid:    PaymentAmounts{Invoice: "1.5", Payment: "1.5"},
+			},
+		},
+		{
+			title: "overpayment refunded",
+			detail: &InvoiceDetail{
+				InvoiceAmount: "10.5", InvoiceAssetCode: "USDT", PaymentAssetCode: "USDT",
+				Transactions: []InvoiceTransaction{
+					{ID: "1", Type: "Deposit", Asset: "USDT", Amount: "12", Status: TransactionStatusProcessed},
+					{ID: "2", Type: "Refund", Asset: "USDT", Amount: "1.5", Status: TransactionStatusProcessed},
+					{ID: "3", Type: "Refund", Asset: "USDT", Amount: "1.5", Status: TransactionStatusCanceled},
+					{ID: "4", Type: "Withdraw", Asset: "USDT", Amount: "5", Status: TransactionStatusProcessed},
+				},
+			},
+			want: PaymentBalance{
+				InvoiceAsset: "USDT", PaymentAsset: "USDT",
+				Expected:    PaymentAmounts{Invoice: "10.5", Payment: "10.5"},
+				Paid:        PaymentAmounts{Invoice: "10.5", Payment: "10.5"},
+				Outstanding: PaymentAmounts{Invoice: "0", Payment: "0"},
+				Overpaid:    PaymentAmounts{Invoice: "0", Payment: "0"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, err := NewPaymentBalance(test.detail)
+			if err != nil {
+				t.Fatalf("NewPaymentBalance returned error: %v", err)
+			}
+			got.paid, got.outstanding, got.overpaid = nil, nil, nil
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("NewPaymentBalance returned %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewPaymentBalance_errors(t *testing.T) {
+	tests := []struct {
+		title  string
+		detail *InvoiceDetail
+	}{
+		{"invalid invoice amount", &InvoiceDetail{InvoiceAmount: "abc"}},
+		{"unknown payment amount", &InvoiceDetail{InvoiceAmount: "1", InvoiceAssetCode: "USDT", PaymentAssetCode: "BTC"}},
+		{"transaction in other asset", &InvoiceDetail{
+			InvoiceAmount: "1", InvoiceAssetCode: "USDT",
+			Transactions: []InvoiceTransaction{{ID: "1", Type: "Deposit", Asset: "BTC", Amount: "1", Status: TransactionStatusProcessed}},
+		}},
+		{"invalid transaction amount", &InvoiceDetail{
+			InvoiceAmount: "1", InvoiceAssetCode: "USDT",
+			Transactions: []InvoiceTransaction{{ID: "1", Type: "Deposit", Amount: "one", Status: TransactionStatusProcessed}},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			if _, err := NewPaymentBalance(test.detail); err == nil {
+				t.Errorf("NewPaymentBalance returned nil, want error")
+			}
+		})
+	}
+}
+
+func TestInvoiceService_ResolvePartialPayment(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	topUps := `[]`
+	body := `{"amount":"33.34","asset":"UAH","externalOrderId":"order-topup","productDescription":"Product"}`
+	mux.HandleFunc("/v1/invoice", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			testURL(t, r, "/v1/invoice?externalOrderId=order-topup&take=100")
+			fmt.Fprintf(w, `{"data":%s}`, topUps)
+			return
+		}
+		testBody(t, r, body+"\n")
+		fmt.Fprint(w, `{"data":{"id":"topup","paymentLink":"https://example.com/invoice/topup"}}`)
+	})
+	mux.HandleFunc("/v1/invoice/topup", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"data":{"id":"topup","externalOrderId":"order-topup","invoiceAmount":"33.34","invoiceAssetCode":"UAH","paymentAmount":"1","paymentAssetCode":"USDT",`+
+			`"transactions":[{"id":"2","type":"Deposit","asset":"USDT","amount":"0.5","status":"Processed"}]}}`)
+	})
+
+	partial := func(paid string) *InvoiceDetail {
+		return &InvoiceDetail{
+			ID: "invoice", ExternalOrderID: "order", ProductDescription: "Product",
+			InvoiceAmount: "100.00", InvoiceAssetCode: "UAH", PaymentAmount: "3", PaymentAssetCode: "USDT",
+			Transactions: []InvoiceTransaction{{ID: "1", Type: "Deposit", Asset: "USDT", Amount: paid, Status: TransactionStatusProcessed}},
+		}
+	}
+	ctx := context.Background()
+
+	got, err := client.Invoice.ResolvePartialPayment(ctx, partial("2"), &PartialPaymentPolicy{CreateTopUp: true})
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if got.Action != PartialPaymentTopUp || got.TopUp.Amount != "33.34" {
+		t.Errorf("Invoice.ResolvePartialPayment returned %v with top-up %+v", got.Action, got.TopUp)
+	}
+	if got.TopUpInvoice == nil || got.TopUpInvoice.ID != "topup" || !got.TopUpInvoice.Created {
+		t.Errorf("Invoice.ResolvePartialPayment returned top-up invoice %+v", got.TopUpInvoice)
+	}
+
+	got, err = client.Invoice.ResolvePartialPayment(ctx, partial("2.999"), &PartialPaymentPolicy{Tolerance: "0.5"})
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if got.Action != PartialPaymentAccept {
+		t.Errorf("Invoice.ResolvePartialPayment returned %v, want %v", got.Action, PartialPaymentAccept)
+	}
+
+	got, err = client.Invoice.ResolvePartialPayment(ctx, partial("3.3"), nil)
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if want := (PaymentAmounts{Invoice: "10", Payment: "0.3"}); got.Action != PartialPaymentRefund || got.Refund != want {
+		t.Errorf("Invoice.ResolvePartialPayment returned %v with refund %+v, want %v with %+v", got.Action, got.Refund, PartialPaymentRefund, want)
+	}
+
+	// An explicit precision of 0 rounds the top-up up to whole units.
+	precision := 0
+	body = `{"amount":"34","asset":"UAH","externalOrderId":"order-topup","productDescription":"Product"}`
+	got, err = client.Invoice.ResolvePartialPayment(ctx, partial("2"), &PartialPaymentPolicy{CreateTopUp: true, Precision: &precision})
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if got.TopUp.Amount != "34" {
+		t.Errorf("Invoice.ResolvePartialPayment returned top-up %+v, want amount 34", got.TopUp)
+	}
+
+	// The top-up invoice paid half of the outstanding amount, so the next
+	// top-up asks only for the rest.
+	topUps = `[{"id":"topup","externalOrderId":"order-topup","invoiceAmount":"33.34","invoiceAssetCode":"UAH","status":"PAID"}]`
+	body = `{"amount":"16.67","asset":"UAH","externalOrderId":"order-topup","productDescription":"Product"}`
+	got, err = client.Invoice.ResolvePartialPayment(ctx, partial("2"), &PartialPaymentPolicy{CreateTopUp: true})
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if got.Action != PartialPaymentTopUp || got.TopUp.Amount != "16.67" || got.TopUpPaid != "16.67" {
+		t.Errorf("Invoice.ResolvePartialPayment returned %v with top-up %+v and top-up paid %s", got.Action, got.TopUp, got.TopUpPaid)
+	}
+
+	// A partially paid top-up invoice that is still open is the resolution
+	// rather than a second top-up, which would conflict with it.
+	topUps = `[{"id":"topup","externalOrderId":"order-topup","invoiceAmount":"33.34","invoiceAssetCode":"UAH","status":"PARTIALLY_PAID"}]`
+	body = "no top-up invoice is created"
+	got, err = client.Invoice.ResolvePartialPayment(ctx, partial("2"), &PartialPaymentPolicy{CreateTopUp: true})
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if got.Action != PartialPaymentTopUp || got.TopUp != nil || got.TopUpPaid != "16.67" {
+		t.Errorf("Invoice.ResolvePartialPayment returned %v with top-up %+v and top-up paid %s", got.Action, got.TopUp, got.TopUpPaid)
+	}
+	if got.TopUpInvoice == nil || got.TopUpInvoice.ID != "topup" || got.TopUpInvoice.Created {
+		t.Errorf("Invoice.ResolvePartialPayment returned top-up invoice %+v, want the open one", got.TopUpInvoice)
+	}
+
+	// Once the top-up invoice is paid, the invoice is resolved.
+	got, err = client.Invoice.ResolvePartialPayment(ctx, partial("2.5"), nil)
+	if err != nil {
+		t.Fatalf("Invoice.ResolvePartialPayment returned error: %v", err)
+	}
+	if got.Action != PartialPaymentAccept {
+		t.Errorf("Invoice.ResolvePartialPayment returned %v, want %v", got.Action, PartialPaymentAccept)
+	}
+
+	if _, err := client.Invoice.ResolvePartialPayment(ctx, partial("2"), &PartialPaymentPolicy{Tolerance: "-1"}); err == nil {
+		t.Errorf("Invoice.ResolvePartialPayment with negative tolerance returned nil, want error")
+	}
+}
+
+func TestPartialPaymentAction_String(t *testing.T) {
+	for action, want := range map[PartialPaymentAction]string{
+		PartialPaymentAccept:    "accept",
+		PartialPaymentTopUp:     "top-up",
+		PartialPaymentRefund:    "refund",
+		PartialPaymentAction(9): "PartialPaymentAction(9)",
+	} {
+		if got := action.String(); got != want {
+			t.Errorf("PartialPaymentAction.String returned %q, want %q", got, want)
+		}
+	}
+}
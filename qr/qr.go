@@ -0,0 +1,596 @@
+// Package qr encodes text, such as invoice payment links or deposit addresses,
+// as QR codes and renders them as PNG, SVG or terminal output.
+//
+// The encoder is written in pure Go and supports byte mode data in
+// all 40 versions and 4 error correction levels of the QR code Model 2.
+package qr
+
+import (
+	"errors"
+)
+
+// Level is the error correction level of the QR code.
+type Level int
+
+// The error correction levels, from the lowest to the highest.
+// The zero Level is not a valid level, so options can leave it unset.
+const (
+	Low      Level = iota + 1 // Recovers about 7% of the data.
+	Medium                    // Recovers about 15% of the data.
+	Quartile                  // Recovers about 25% of the data.
+	High                      // Recovers about 30% of the data.
+)
+
+// ErrTooLong is returned when the text does not fit into the largest QR code
+// with the requested error correction level.
+var ErrTooLong = errors.New("qr: text is too long")
+
+// Code is an encoded QR code.
+type Code struct {
+	version int
+	level   Level
+	size    int
+
+	// modules holds the dark modules, indexed by row and then column.
+	modules [][]bool
+}
+
+// Encode encodes the text as a QR code with the smallest version that fits
+// the text at the requested error correction level.
+func Encode(text string, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, errors.New("qr: invalid error correction level")
+	}
+
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if 4+charCountBits(v)+8*len(data) <= numDataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	b := newBuilder(version, level)
+	b.drawFunctionPatterns()
+	b.drawCodewords(b.addErrorCorrection(encodeData(data, version, level)))
+	b.applyBestMask()
+
+	return b.Code, nil
+}
+
+// Size returns the number of modules on each side of the code,
+// not including the quiet zone.
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Version returns the version of the code, from 1 to 40.
+func (c *Code) Version() int {
+	return c.version
+}
+
+// Level returns the error correction level of the code.
+func (c *Code) Level() Level {
+	return c.level
+}
+
+// Dark reports whether the module at column x and row y is dark.
+// Modules outside of the code, e.g. in the quiet zone, are light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.size || y >= c.size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// builder holds the state needed only while the code is being encoded.
+type builder struct {
+	*Code
+	function [][]bool
+}
+
+func newBuilder(version int, level Level) *builder {
+	size := version*4 + 17
+	b := &builder{
+		Code: &Code{
+			version: version,
+			level:   level,
+			size:    size,
+			modules: make([][]bool, size),
+		},
+		function: make([][]bool, size),
+	}
+	for i := 0; i < size; i++ {
+		b.modules[i] = make([]bool, size)
+		b.function[i] = make([]bool, size)
+	}
+
+	return b
+}
+
+// eccCodewordsPerBlock is the number of error correction codewords
+// in each block, indexed by level minus one and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// numErrorCorrectionBlocks is the number of error correction blocks,
+// indexed by level minus one and version.
+var numErrorCorrectionBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// formatLevelBits maps the error correction level minus one to its format
+// information bits.
+var formatLevelBits = [4]int{1, 0, 3, 2}
+
+// numRawDataModules returns the number of modules available for the data
+// and error correction codewords, including the remainder bits.
+func numRawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		n -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+
+	return n
+}
+
+// numDataCodewords returns the number of the data codewords.
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 -
+		eccCodewordsPerBlock[level-1][version]*numErrorCorrectionBlocks[level-1][version]
+}
+
+// charCountBits returns the length of the character count indicator in byte mode.
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// alignmentPatternPositions returns the centers of the alignment patterns
+// on each axis.
+func alignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	return positions
+}
+
+// encodeData encodes the text in byte mode and pads it to the data capacity.
+func encodeData(data []byte, version int, level Level) []byte {
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	bb.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacity := numDataCodewords(version, level) * 8
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	return codewords
+}
+
+// addErrorCorrection splits the data into blocks, appends the error correction
+// codewords to each block and interleaves the blocks.
+func (c *Code) addErrorCorrection(data []byte) []byte {
+	numBlocks := numErrorCorrectionBlocks[c.level-1][c.version]
+	blockEccLen := eccCodewordsPerBlock[c.level-1][c.version]
+	rawCodewords := numRawDataModules(c.version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockEccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		datLen := shortBlockLen - blockEccLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+datLen]...)
+		k += datLen
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			// Skip the padding byte of the short blocks.
+			if i != shortBlockLen-blockEccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	return result
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns,
+// and reserves the format and version information areas.
+func (b *builder) drawFunctionPatterns() {
+	for i := 0; i < b.size; i++ {
+		b.setFunction(6, i, i%2 == 0)
+		b.setFunction(i, 6, i%2 == 0)
+	}
+
+	b.drawFinderPattern(3, 3)
+	b.drawFinderPattern(b.size-4, 3)
+	b.drawFinderPattern(3, b.size-4)
+
+	positions := alignmentPatternPositions(b.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the corners occupied by the finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			b.drawAlignmentPattern(x, y)
+		}
+	}
+
+	b.drawFormatBits(0)
+	b.drawVersion()
+}
+
+func (b *builder) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= b.size || yy >= b.size {
+				continue
+			}
+			dist := maxInt(absInt(dx), absInt(dy))
+			b.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (b *builder) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			b.setFunction(x+dx, y+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the 15-bit format information for the level and mask.
+func formatBits(level Level, mask int) int {
+	data := formatLevelBits[level-1]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (b *builder) drawFormatBits(mask int) {
+	bits := formatBits(b.level, mask)
+
+	// The first copy around the top left finder pattern.
+	for i := 0; i <= 5; i++ {
+		b.setFunction(8, i, bit(bits, i))
+	}
+	b.setFunction(8, 7, bit(bits, 6))
+	b.setFunction(8, 8, bit(bits, 7))
+	b.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		b.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// The second copy split between the other two finder patterns.
+	for i := 0; i < 8; i++ {
+		b.setFunction(b.size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		b.setFunction(8, b.size-15+i, bit(bits, i))
+	}
+	b.setFunction(8, b.size-8, true)
+}
+
+// versionBits returns the 18-bit version information.
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+
+	return version<<12 | rem
+}
+
+func (b *builder) drawVersion() {
+	if b.version < 7 {
+		return
+	}
+
+	bits := versionBits(b.version)
+	for i := 0; i < 18; i++ {
+		x, y := b.size-11+i%3, i/3
+		b.setFunction(x, y, bit(bits, i))
+		b.setFunction(y, x, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order,
+// skipping the function modules.
+func (b *builder) drawCodewords(codewords []byte) {
+	i := 0
+	for right := b.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < b.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = b.size - 1 - vert
+				}
+				if !b.function[y][x] && i < len(codewords)*8 {
+					b.modules[y][x] = bit(int(codewords[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// masked reports whether the mask pattern flips the module at column x and row y.
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask flips the data modules by the mask pattern.
+// Applying the same mask twice restores the modules.
+func (b *builder) applyMask(mask int) {
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			if !b.function[y][x] && masked(mask, x, y) {
+				b.modules[y][x] = !b.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask pattern with the lowest penalty score.
+func (b *builder) applyBestMask() {
+	best, minPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		b.applyMask(mask)
+		b.drawFormatBits(mask)
+		if p := b.penalty(); minPenalty < 0 || p < minPenalty {
+			best, minPenalty = mask, p
+		}
+		b.applyMask(mask)
+	}
+
+	b.applyMask(best)
+	b.drawFormatBits(best)
+}
+
+// Penalty weights of the mask evaluation rules.
+const (
+	penaltyN1 = 3
+	penaltyN2 = 3
+	penaltyN3 = 40
+	penaltyN4 = 10
+)
+
+// penalty calculates the penalty score of the current modules.
+func (b *builder) penalty() int {
+	n := b.size
+	score := 0
+
+	for i := 0; i < n; i++ {
+		row := func(j int) bool { return b.modules[i][j] }
+		col := func(j int) bool { return b.modules[j][i] }
+		score += linePenalty(n, row) + linePenalty(n, col)
+	}
+
+	for y := 0; y < n-1; y++ {
+		for x := 0; x < n-1; x++ {
+			c := b.modules[y][x]
+			if c == b.modules[y][x+1] && c == b.modules[y+1][x] && c == b.modules[y+1][x+1] {
+				score += penaltyN2
+			}
+		}
+	}
+
+	dark := 0
+	for _, row := range b.modules {
+		for _, m := range row {
+			if m {
+				dark++
+			}
+		}
+	}
+	total := n * n
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	score += k * penaltyN4
+
+	return score
+}
+
+// finderLike is the 1:1:3:1:1 pattern with 4 light modules on one side.
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// linePenalty calculates the penalty of the runs of modules of the same color
+// and of the finder-like patterns in a single row or column.
+func linePenalty(n int, at func(int) bool) int {
+	score := 0
+
+	run := 1
+	for i := 1; i <= n; i++ {
+		if i < n && at(i) == at(i-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += penaltyN1 + run - 5
+		}
+		run = 1
+	}
+
+	for i := 0; i+11 <= n; i++ {
+		for _, pattern := range finderLike {
+			match := true
+			for j, dark := range pattern {
+				if at(i+j) != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				score += penaltyN3
+			}
+		}
+	}
+
+	return score
+}
+
+func (b *builder) setFunction(x, y int, dark bool) {
+	b.modules[y][x] = dark
+	b.function[y][x] = true
+}
+
+// reedSolomonDivisor returns the generator polynomial of the degree,
+// with the coefficients from the highest to the lowest power,
+// excluding the leading term.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords of the data.
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+
+	return result
+}
+
+// gfMultiply multiplies two elements of GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+
+	return byte(z)
+}
+
+// bitBuffer is a sequence of bits.
+type bitBuffer []bool
+
+// append appends the n lowest bits of the value, from the highest to the lowest.
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (value>>uint(i))&1 != 0)
+	}
+}
+
+func bit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,331 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		title   string
+		text    string
+		level   Level
+		version int
+	}{
+		{"empty", "", Low, 1},
+		{"largest version 1", strings.Repeat("a", 17), Low, 1},
+		{"smallest version 2", strings.Repeat("a", 18), Low, 2},
+		{"payment link", "https://pay.kuna.io/invoice/c94c0c95-e735-45ea-982e-a95f7f52ca49", Medium, 5},
+		{"deposit address", "tb1q0xrgwsd7e0uad3sy98klppjwjq26023mcx224d", High, 5},
+		{"version information", strings.Repeat("x", 200), Quartile, 12},
+		{"multiple block sizes", strings.Repeat("z", 1000), Medium, 26},
+		{"largest capacity", strings.Repeat("9", 2953), Low, 40},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			c, err := Encode(test.text, test.level)
+			if err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			if c.Version() != test.version {
+				t.Errorf("Encode version is %d, want %d", c.Version(), test.version)
+			}
+			if c.Size() != test.version*4+17 {
+				t.Errorf("Encode size is %d, want %d", c.Size(), test.version*4+17)
+			}
+			if c.Level() != test.level {
+				t.Errorf("Encode level is %d, want %d", c.Level(), test.level)
+			}
+
+			got, err := decode(c)
+			if err != nil {
+				t.Fatalf("decode returned error: %v", err)
+			}
+			if got != test.text {
+				t.Errorf("decode returned %q, want %q", got, test.text)
+			}
+		})
+	}
+}
+
+func TestEncode_errors(t *testing.T) {
+	if _, err := Encode(strings.Repeat("9", 2954), Low); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode returned %v, want %v", err, ErrTooLong)
+	}
+	for _, level := range []Level{0, 5} {
+		if _, err := Encode("text", level); err == nil {
+			t.Errorf("Encode with invalid level %d returned nil, want error", level)
+		}
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	tests := []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{Low, 0, 0b111011111000100},
+		{Medium, 0, 0b101010000010010},
+		{Quartile, 0, 0b011010101011111},
+		{High, 0, 0b001011010001001},
+		{Medium, 5, 0b100000011001110},
+	}
+
+	for _, test := range tests {
+		if got := formatBits(test.level, test.mask); got != test.want {
+			t.Errorf("formatBits(%d, %d) = %015b, want %015b", test.level, test.mask, got, test.want)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	if got, want := versionBits(7), 0b000111110010010100; got != want {
+		t.Errorf("versionBits(7) = %018b, want %018b", got, want)
+	}
+	if got, want := versionBits(40), 0b101000110001101001; got != want {
+		t.Errorf("versionBits(40) = %018b, want %018b", got, want)
+	}
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+
+	for version, want := range tests {
+		if got := alignmentPatternPositions(version); !reflect.DeepEqual(got, want) {
+			t.Errorf("alignmentPatternPositions(%d) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// The data codewords of "HELLO WORLD" in version 1-M.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !reflect.DeepEqual(got, want) {
+		t.Errorf("reedSolomonRemainder returned %v, want %v", got, want)
+	}
+}
+
+func TestCode_PNG(t *testing.T) {
+	c, _ := Encode("https://example.com", Medium)
+
+	data, err := c.PNG(&Options{Size: 300, Margin: 4})
+	if err != nil {
+		t.Fatalf("Code.PNG returned error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode returned error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+		t.Errorf("Code.PNG image size is %v, want 300x300", b.Size())
+	}
+
+	// 33 modules with the margin, scaled by 9 pixels and centered,
+	// so the top left finder pattern starts at 1+4*9 pixels.
+	for _, p := range []struct {
+		x, y int
+		dark bool
+	}{
+		{0, 0, false},
+		{36, 36, false},
+		{37, 37, true},
+		{45, 45, true},
+		{46, 46, false},
+	} {
+		r, _, _, _ := img.At(p.x, p.y).RGBA()
+		if dark := r == 0; dark != p.dark {
+			t.Errorf("Code.PNG pixel (%d, %d) dark = %v, want %v", p.x, p.y, dark, p.dark)
+		}
+	}
+
+	small := c.Image(&Options{Size: 10, Margin: -1})
+	if b := small.Bounds(); b.Dx() != c.Size() {
+		t.Errorf("Code.Image size is %d, want %d", b.Dx(), c.Size())
+	}
+}
+
+func TestCode_SVG(t *testing.T) {
+	c, _ := Encode("https://example.com", Medium)
+
+	svg := c.SVG(nil)
+	for _, want := range []string{`viewBox="0 0 33 33"`, `width="256"`, `M4,4h1v1h-1z`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Code.SVG returned %s, want it to contain %s", svg, want)
+		}
+	}
+	if strings.Contains(svg, "M3,3") {
+		t.Errorf("Code.SVG draws a module in the quiet zone")
+	}
+
+	// An unset margin keeps the quiet zone and a negative one removes it.
+	if svg := c.SVG(&Options{Size: 100}); !strings.Contains(svg, `viewBox="0 0 33 33"`) {
+		t.Errorf("Code.SVG without margin returned %s, want the 4 module quiet zone", svg)
+	}
+	if svg := c.SVG(&Options{Margin: -1}); !strings.Contains(svg, `viewBox="0 0 25 25"`) {
+		t.Errorf("Code.SVG with negative margin returned %s, want no quiet zone", svg)
+	}
+}
+
+func TestCode_Terminal(t *testing.T) {
+	c, _ := Encode("https://example.com", Medium)
+
+	out := c.Terminal(&Options{Margin: 1})
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 14 {
+		t.Errorf("Code.Terminal returned %d lines, want 14", len(lines))
+	}
+	if got := []rune(lines[0]); len(got) != 27 || got[0] != ' ' || got[1] != '▄' {
+		t.Errorf("Code.Terminal first line is %q", lines[0])
+	}
+
+	inverted := c.Terminal(&Options{Margin: 1, Invert: true})
+	if got := []rune(strings.Split(inverted, "\n")[0]); got[0] != '█' || got[1] != '▀' {
+		t.Errorf("Code.Terminal inverted first line is %q", string(got))
+	}
+}
+
+// decode reads the text back from the code.
+func decode(c *Code) (string, error) {
+	var raw, copied int
+	read := func(v *int, x, y, i int) {
+		if c.modules[y][x] {
+			*v |= 1 << uint(i)
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(&raw, 8, i, i)
+	}
+	read(&raw, 8, 7, 6)
+	read(&raw, 8, 8, 7)
+	read(&raw, 7, 8, 8)
+	for i := 9; i < 15; i++ {
+		read(&raw, 14-i, 8, i)
+	}
+	for i := 0; i < 8; i++ {
+		read(&copied, c.size-1-i, 8, i)
+	}
+	for i := 8; i < 15; i++ {
+		read(&copied, 8, c.size-15+i, i)
+	}
+	if raw != copied || !c.modules[c.size-8][8] {
+		return "", errors.New("format information copies differ")
+	}
+
+	var level Level
+	mask := -1
+	for l := Low; l <= High; l++ {
+		for m := 0; m < 8; m++ {
+			if formatBits(l, m) == raw {
+				level, mask = l, m
+			}
+		}
+	}
+	if mask < 0 {
+		return "", errors.New("invalid format information")
+	}
+
+	ref := newBuilder(c.version, level)
+	ref.drawFunctionPatterns()
+
+	var codewords []byte
+	var cur byte
+	n := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if ref.function[y][x] {
+					continue
+				}
+				cur <<= 1
+				if c.modules[y][x] != masked(mask, x, y) {
+					cur |= 1
+				}
+				if n++; n%8 == 0 {
+					codewords = append(codewords, cur)
+					cur = 0
+				}
+			}
+		}
+	}
+
+	numBlocks := numErrorCorrectionBlocks[level-1][c.version]
+	eccLen := eccCodewordsPerBlock[level-1][c.version]
+	rawCodewords := numRawDataModules(c.version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortDataLen := rawCodewords/numBlocks - eccLen
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortDataLen; i++ {
+		for j := range blocks {
+			if i < shortDataLen || j >= numShortBlocks {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, block...)
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+	divisor := reedSolomonDivisor(eccLen)
+	for _, block := range blocks {
+		dataLen := len(block) - eccLen
+		if got := reedSolomonRemainder(block[:dataLen], divisor); !bytes.Equal(got, block[dataLen:]) {
+			return "", errors.New("invalid error correction codewords")
+		}
+	}
+
+	var bits bitBuffer
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	value := func(from, n int) int {
+		v := 0
+		for _, b := range bits[from : from+n] {
+			v <<= 1
+			if b {
+				v |= 1
+			}
+		}
+		return v
+	}
+	if value(0, 4) != 0x4 {
+		return "", errors.New("not a byte mode segment")
+	}
+	ccBits := charCountBits(c.version)
+	count := value(4, ccBits)
+	text := make([]byte, count)
+	for i := range text {
+		text[i] = byte(value(4+ccBits+8*i, 8))
+	}
+
+	return string(text), nil
+}
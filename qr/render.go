@@ -0,0 +1,155 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// Options specifies the rendering options of the QR code.
+type Options struct {
+	// Size is the width and height of the PNG and SVG images in pixels.
+	// PNG modules are scaled by whole pixels, and the remaining pixels
+	// widen the quiet zone. If the size is smaller than the code,
+	// every module takes a single pixel.
+	Size int
+
+	// Margin is the width of the quiet zone around the code in modules.
+	// The QR code specification requires at least 4 modules, the default.
+	// A negative margin renders the code without a quiet zone.
+	Margin int
+
+	// Invert swaps the dark and light modules in the terminal output,
+	// for terminals with a dark background.
+	Invert bool
+}
+
+// DefaultOptions are the options used when nil options are passed.
+var DefaultOptions = Options{Size: 256, Margin: 4}
+
+func (o *Options) orDefault() Options {
+	if o == nil {
+		return DefaultOptions
+	}
+
+	opts := *o
+	switch {
+	case opts.Margin == 0:
+		opts.Margin = DefaultOptions.Margin
+	case opts.Margin < 0:
+		opts.Margin = 0
+	}
+
+	return opts
+}
+
+// Image returns the code as an image.
+func (c *Code) Image(opts *Options) image.Image {
+	o := opts.orDefault()
+
+	modules := c.size + 2*o.Margin
+	scale := o.Size / modules
+	if scale < 1 {
+		scale = 1
+	}
+	size := modules * scale
+	offset := 0
+	if o.Size > size {
+		offset = (o.Size - size) / 2
+		size = o.Size
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			px := offset + (x+o.Margin)*scale
+			py := offset + (y+o.Margin)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(px+dx, py+dy, 1)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// PNG returns the code as a PNG image.
+func (c *Code) PNG(opts *Options) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.Image(opts)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SVG returns the code as an SVG image. The image scales without loss,
+// so the modules do not have to fit the size in whole pixels.
+func (c *Code) SVG(opts *Options) string {
+	o := opts.orDefault()
+	modules := c.size + 2*o.Margin
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" viewBox="0 0 %d %d"`, modules, modules)
+	if o.Size > 0 {
+		fmt.Fprintf(&sb, ` width="%d" height="%d"`, o.Size, o.Size)
+	}
+	sb.WriteString(` shape-rendering="crispEdges">`)
+	sb.WriteString(`<rect width="100%" height="100%" fill="#FFFFFF"/>`)
+	sb.WriteString(`<path d="`)
+	first := true
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			if !first {
+				sb.WriteByte(' ')
+			}
+			first = false
+			fmt.Fprintf(&sb, "M%d,%dh1v1h-1z", x+o.Margin, y+o.Margin)
+		}
+	}
+	sb.WriteString(`" fill="#000000"/></svg>`)
+
+	return sb.String()
+}
+
+// Terminal returns the code as text for the terminal. Every character
+// holds two modules stacked vertically, using the Unicode half blocks.
+// Dark modules are drawn with the foreground color.
+func (c *Code) Terminal(opts *Options) string {
+	o := opts.orDefault()
+	lo, hi := -o.Margin, c.size+o.Margin
+
+	dark := func(x, y int) bool {
+		return c.Dark(x, y) != o.Invert
+	}
+
+	var sb strings.Builder
+	for y := lo; y < hi; y += 2 {
+		for x := lo; x < hi; x++ {
+			switch top, bottom := dark(x, y), dark(x, y+1); {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
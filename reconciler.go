@@ -0,0 +1,261 @@
+package kunapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sources of the invoice events.
+const (
+	InvoiceEventSourceWebhook = "webhook"
+	InvoiceEventSourcePoll    = "poll"
+)
+
+// InvoiceEvent represents a change of the invoice status.
+type InvoiceEvent struct {
+	InvoiceID      string
+	PreviousStatus InvoiceStatus
+	Status         InvoiceStatus
+	Source         string
+	OccurredAt     time.Time
+
+	// Invoice holds the invoice details if they are known
+	// at the time the event is created.
+	Invoice *InvoiceDetail
+}
+
+// InvoiceHandler handles the invoice status changes.
+// It is shared by every component that delivers invoice updates,
+// so the business logic runs once per status change regardless of its source.
+type InvoiceHandler func(ctx context.Context, e *InvoiceEvent) error
+
+// ReconcilerOpts specifies the optional parameters to the Reconciler.
+type ReconcilerOpts struct {
+	// Interval between the reconciliation passes. Defaults to one minute.
+	Interval time.Duration
+
+	// Threshold after which an invoice without updates is polled.
+	// Defaults to five minutes.
+	Threshold time.Duration
+
+	// Retention is how long invoices in a terminal status are remembered
+	// to drop repeated updates for them. Defaults to 24 hours.
+	Retention time.Duration
+}
+
+// Reconciler keeps track of non-terminal invoices and polls the ones
+// that have not been updated for a while, so callbacks lost while
+// the service was down still reach the handler.
+type Reconciler struct {
+	client    *Client
+	handler   InvoiceHandler
+	interval  time.Duration
+	threshold time.Duration
+	retention time.Duration
+
+	mu       sync.Mutex
+	invoices map[string]*reconciledInvoice
+
+	now func() time.Time
+}
+
+// reconciledInvoice is the last known state of a tracked invoice.
+// The state fields are guarded by the Reconciler mutex.
+type reconciledInvoice struct {
+	// mu serializes the handler calls for the invoice.
+	mu sync.Mutex
+
+	status InvoiceStatus
+	seenAt time.Time
+	done   bool
+}
+
+// NewReconciler returns a new Reconciler that delivers status changes to the handler.
+func NewReconciler(client *Client, handler InvoiceHandler, opts *ReconcilerOpts) *Reconciler {
+	r := &Reconciler{
+		client:    client,
+		handler:   handler,
+		interval:  time.Minute,
+		threshold: 5 * time.Minute,
+		retention: 24 * time.Hour,
+		invoices:  make(map[string]*reconciledInvoice),
+		now:       time.Now,
+	}
+	if opts != nil {
+		if opts.Interval > 0 {
+			r.interval = opts.Interval
+		}
+		if opts.Threshold > 0 {
+			r.threshold = opts.Threshold
+		}
+		if opts.Retention > 0 {
+			r.retention = opts.Retention
+		}
+	}
+
+	return r
+}
+
+// Track starts tracking the invoice with the last known status.
+// Invoices in a terminal status are ignored.
+func (r *Reconciler) Track(id string, status InvoiceStatus) {
+	if status.IsTerminal() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.invoices[id]; !ok {
+		r.invoices[id] = &reconciledInvoice{status: status, seenAt: r.now()}
+	}
+}
+
+// Untrack stops tracking the invoice and forgets its status.
+func (r *Reconciler) Untrack(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.invoices, id)
+}
+
+// Len returns the number of tracked non-terminal invoices.
+func (r *Reconciler) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for _, inv := range r.invoices {
+		if !inv.done {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Deliver passes an invoice update received from outside of the reconciler,
+// e.g. from a webhook callback, to the handler. The update is dropped if
+// the status is already known, so the handler is not called twice for
+// the same change. Unknown invoices are tracked automatically.
+func (r *Reconciler) Deliver(ctx context.Context, e *InvoiceEvent) error {
+	if strings.TrimSpace(e.InvoiceID) == "" {
+		return fmt.Errorf("invoice ID is required")
+	}
+	if e.Source == "" {
+		e.Source = InvoiceEventSourceWebhook
+	}
+
+	r.mu.Lock()
+	inv, ok := r.invoices[e.InvoiceID]
+	if !ok {
+		inv = &reconciledInvoice{seenAt: r.now()}
+		r.invoices[e.InvoiceID] = inv
+	}
+	r.mu.Unlock()
+
+	return r.dispatch(ctx, e, inv)
+}
+
+// Reconcile runs a single reconciliation pass. Every tracked invoice that has
+// not been updated within the threshold is fetched, and a status change
+// is delivered to the handler. Invoices that reached a terminal status
+// longer than the retention ago are forgotten.
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	now := r.now()
+
+	r.mu.Lock()
+	stale := make(map[string]*reconciledInvoice)
+	for id, inv := range r.invoices {
+		switch {
+		case inv.done && now.Sub(inv.seenAt) >= r.retention:
+			delete(r.invoices, id)
+		case !inv.done && now.Sub(inv.seenAt) >= r.threshold:
+			stale[id] = inv
+		}
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for id, inv := range stale {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		detail, _, err := r.client.Invoice.Get(ctx, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reconcile invoice %s: %w", id, err))
+			continue
+		}
+		if detail == nil {
+			errs = append(errs, fmt.Errorf("reconcile invoice %s: empty response", id))
+			continue
+		}
+
+		e := &InvoiceEvent{
+			InvoiceID: id,
+			Status:    detail.Status,
+			Source:    InvoiceEventSourcePoll,
+			Invoice:   detail,
+		}
+		if err := r.dispatch(ctx, e, inv); err != nil {
+			errs = append(errs, fmt.Errorf("reconcile invoice %s: %w", id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run runs the reconciliation passes with the configured interval
+// until the context is canceled. Errors of the individual passes
+// do not stop the reconciler.
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			_ = r.Reconcile(ctx)
+		}
+	}
+}
+
+// dispatch calls the handler if the event changes the known invoice status.
+// The known status is updated only after the handler succeeds,
+// so a failed change is delivered again on the next update or pass.
+func (r *Reconciler) dispatch(ctx context.Context, e *InvoiceEvent, inv *reconciledInvoice) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	r.mu.Lock()
+	now := r.now()
+	inv.seenAt = now
+	skip := inv.done || e.Status == inv.status
+	e.PreviousStatus = inv.status
+	r.mu.Unlock()
+
+	if skip {
+		return nil
+	}
+
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = now
+	}
+	if err := r.handler(ctx, e); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	inv.status = e.Status
+	inv.done = e.Status.IsTerminal()
+	r.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package kunapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconciler_Reconcile(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	status := InvoiceStatusPaymentAwaiting
+	mux.HandleFunc("/v1/invoice/c94c0c95-e735-45ea-982e-a95f7f52ca49", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprintf(w, `{"data":{"id":"c94c0c95-e735-45ea-982e-a95f7f52ca49","status":%q}}`, status)
+	})
+
+	var got []string
+	handler := func(ctx context.Context, e *InvoiceEvent) error {
+		got = append(got, string(e.PreviousStatus)+"->"+string(e.Status)+"/"+e.Source)
+		return nil
+	}
+
+	now := time.Date(2023, 7, 30, 0, 0, 0, 0, time.UTC)
+	r := NewReconciler(client, handler, &ReconcilerOpts{Threshold: time.Minute})
+	r.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	r.Track("c94c0c95-e735-45ea-982e-a95f7f52ca49", InvoiceStatusCreated)
+
+	// The invoice was updated recently, so it is not polled.
+	if err := r.Reconcile(ctx); err != nil {
+		t.Errorf("Reconciler.Reconcile returned error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Reconciler.Reconcile delivered %v, want none", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := r.Reconcile(ctx); err != nil {
+		t.Errorf("Reconciler.Reconcile returned error: %v", err)
+	}
+
+	// The webhook delivers the same status, which must be dropped.
+	err := r.Deliver(ctx, &InvoiceEvent{
+		InvoiceID: "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+		Status:    InvoiceStatusPaymentAwaiting,
+	})
+	if err != nil {
+		t.Errorf("Reconciler.Deliver returned error: %v", err)
+	}
+
+	status = InvoiceStatusPaid
+	now = now.Add(2 * time.Minute)
+	if err := r.Reconcile(ctx); err != nil {
+		t.Errorf("Reconciler.Reconcile returned error: %v", err)
+	}
+	if n := r.Len(); n != 0 {
+		t.Errorf("Reconciler.Len returned %d, want 0", n)
+	}
+
+	// Repeated callbacks for a terminal invoice must be dropped too.
+	err = r.Deliver(ctx, &InvoiceEvent{
+		InvoiceID: "c94c0c95-e735-45ea-982e-a95f7f52ca49",
+		Status:    InvoiceStatusPaid,
+	})
+	if err != nil {
+		t.Errorf("Reconciler.Deliver returned error: %v", err)
+	}
+
+	want := []string{
+		"CREATED->PAYMENT_AWAITING/poll",
+		"PAYMENT_AWAITING->PAID/poll",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Reconciler delivered %v, want %v", got, want)
+	}
+}
+
+func TestReconciler_DeliverRetriesFailedHandler(t *testing.T) {
+	client, _, teardown := setupClient()
+	defer teardown()
+
+	calls := 0
+	handler := func(ctx context.Context, e *InvoiceEvent) error {
+		calls++
+		if calls == 1 {
+			return errors.New("handler failed")
+		}
+		return nil
+	}
+
+	r := NewReconciler(client, handler, nil)
+	ctx := context.Background()
+	e := func() *InvoiceEvent {
+		return &InvoiceEvent{InvoiceID: "c94c0c95-e735-45ea-982e-a95f7f52ca49", Status: InvoiceStatusPaid}
+	}
+
+	if err := r.Deliver(ctx, e()); err == nil {
+		t.Errorf("Reconciler.Deliver returned nil, want error")
+	}
+	if err := r.Deliver(ctx, e()); err != nil {
+		t.Errorf("Reconciler.Deliver returned error: %v", err)
+	}
+	if err := r.Deliver(ctx, e()); err != nil {
+		t.Errorf("Reconciler.Deliver returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Reconciler handler called %d times, want 2", calls)
+	}
+
+	if err := r.Deliver(ctx, &InvoiceEvent{}); err == nil {
+		t.Errorf("Reconciler.Deliver without invoice ID returned nil, want error")
+	}
+}
+
+func TestReconciler_ReconcileGetError(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice/c94c0c95-e735-45ea-982e-a95f7f52ca49", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	})
+
+	r := NewReconciler(client, func(ctx context.Context, e *InvoiceEvent) error { return nil }, &ReconcilerOpts{Threshold: time.Nanosecond})
+	r.Track("c94c0c95-e735-45ea-982e-a95f7f52ca49", InvoiceStatusCreated)
+	r.Track("terminal", InvoiceStatusPaid)
+
+	if err := r.Reconcile(context.Background()); err == nil {
+		t.Errorf("Reconciler.Reconcile returned nil, want error")
+	}
+	if n := r.Len(); n != 1 {
+		t.Errorf("Reconciler.Len returned %d, want 1", n)
+	}
+}
+
+func TestReconciler_ReconcileEmptyResponse(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice/empty", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":null}`)
+	})
+
+	r := NewReconciler(client, func(ctx context.Context, e *InvoiceEvent) error { return nil }, &ReconcilerOpts{Threshold: time.Nanosecond})
+	r.Track("empty", InvoiceStatusCreated)
+
+	err := r.Reconcile(context.Background())
+	if err == nil || err.Error() != "reconcile invoice empty: empty response" {
+		t.Errorf("Reconciler.Reconcile returned error %v, want empty response", err)
+	}
+	if n := r.Len(); n != 1 {
+		t.Errorf("Reconciler.Len returned %d, want 1", n)
+	}
+}
@@ -0,0 +1,54 @@
+package kunapay
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Refundable returns the amount of the invoice transaction that can still be
+// refunded: its processed amount minus the refunds of the invoice that are
+// not canceled.
+//
+// The invoice transactions do not link a refund to the deposit it returns,
+// so all refunds of the invoice are subtracted from the transaction. For an
+// invoice with more than one deposit the result is a lower bound, and the
+// refundable amounts of its deposits together can be less than the invoice
+// can refund.
+func (d *InvoiceDetail) Refundable(transactionID string) (*big.Rat, error) {
+	var tx *InvoiceTransaction
+	for i := range d.Transactions {
+		if d.Transactions[i].ID == transactionID {
+			tx = &d.Transactions[i]
+		}
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("invoice %s has no transaction %s", d.ID, transactionID)
+	}
+	if tx.Type != TransactionTypeDeposit || !tx.Status.IsSuccessful() {
+		return nil, fmt.Errorf("transaction %s is not a processed deposit", transactionID)
+	}
+
+	amount := tx.ProcessedAmount
+	if amount == "" {
+		amount = tx.Amount
+	}
+	refundable, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("transaction %s amount %q is not a decimal number", transactionID, amount)
+	}
+	for _, refund := range d.Transactions {
+		if refund.Type != TransactionTypeRefund || refund.Status == TransactionStatusCanceled {
+			continue
+		}
+		refunded, ok := new(big.Rat).SetString(refund.Amount)
+		if !ok {
+			return nil, fmt.Errorf("refund %s amount %q is not a decimal number", refund.ID, refund.Amount)
+		}
+		refundable.Sub(refundable, refunded)
+	}
+	if refundable.Sign() < 0 {
+		refundable.SetInt64(0)
+	}
+
+	return refundable, nil
+}
@@ -0,0 +1,58 @@
+package kunapay
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+const refundInvoiceMock = `{"data":{"id":"inv","transactions":[
+	{"id":"dep","type":"Deposit","status":"Processed","amount":"100.00","processedAmount":"90.00"},
+	{"id":"ref","type":"Refund","status":"Processed","amount":"30.00"},
+	{"id":"canceled","type":"Refund","status":"Canceled","amount":"50.00"},
+	{"id":"pending","type":"Deposit","status":"Processing","amount":"10.00"}
+]}}`
+
+func TestInvoiceDetail_Refundable(t *testing.T) {
+	var root struct {
+		Data *InvoiceDetail `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(refundInvoiceMock), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	// The processed amount minus the refund that is not canceled.
+	refundable, err := root.Data.Refundable("dep")
+	if err != nil {
+		t.Fatalf("InvoiceDetail.Refundable returned error: %v", err)
+	}
+	if want := big.NewRat(60, 1); refundable.Cmp(want) != 0 {
+		t.Errorf("InvoiceDetail.Refundable returned %v, want %v", refundable, want)
+	}
+
+	tests := []struct {
+		id  string
+		err string
+	}{
+		{id: "missing", err: "invoice inv has no transaction missing"},
+		{id: "pending", err: "transaction pending is not a processed deposit"},
+		{id: "ref", err: "transaction ref is not a processed deposit"},
+	}
+	for _, test := range tests {
+		if _, err := root.Data.Refundable(test.id); err == nil || err.Error() != test.err {
+			t.Errorf("InvoiceDetail.Refundable(%q) returned error %v, want %q", test.id, err, test.err)
+		}
+	}
+}
+
+func TestInvoiceDetail_RefundableRefunded(t *testing.T) {
+	detail := &InvoiceDetail{ID: "inv", Transactions: []InvoiceTransaction{
+		{ID: "dep", Type: "Deposit", Status: TransactionStatusProcessed, Amount: "10"},
+		{ID: "ref", Type: "Refund", Status: TransactionStatusProcessing, Amount: "12"},
+	}}
+
+	refundable, err := detail.Refundable("dep")
+	if err != nil || refundable.Sign() != 0 {
+		t.Errorf("InvoiceDetail.Refundable returned %v, %v, want 0", refundable, err)
+	}
+}
@@ -0,0 +1,90 @@
+package kunapay
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TransitionError reports an impossible status transition of an invoice or a transaction.
+type TransitionError struct {
+	ID   string
+	From string
+	To   string
+}
+
+// Error returns the string representation of the error.
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("impossible status transition of %s: %s -> %s", e.ID, e.From, e.To)
+}
+
+// InvoiceStatusValidator flags impossible invoice status transitions
+// seen over time. It is safe for concurrent use.
+type InvoiceStatusValidator struct {
+	mu       sync.Mutex
+	statuses map[string]InvoiceStatus
+}
+
+// NewInvoiceStatusValidator returns a new InvoiceStatusValidator.
+func NewInvoiceStatusValidator() *InvoiceStatusValidator {
+	return &InvoiceStatusValidator{statuses: make(map[string]InvoiceStatus)}
+}
+
+// Observe records the status of the invoice. If the invoice cannot move
+// to the status from the previously observed one, a *TransitionError
+// is returned. The status is recorded either way.
+func (v *InvoiceStatusValidator) Observe(id string, status InvoiceStatus) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	prev, ok := v.statuses[id]
+	v.statuses[id] = status
+	if ok && !prev.CanTransitionTo(status) {
+		return &TransitionError{ID: id, From: string(prev), To: string(status)}
+	}
+
+	return nil
+}
+
+// Forget removes the invoice from the validator.
+func (v *InvoiceStatusValidator) Forget(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.statuses, id)
+}
+
+// TransactionStatusValidator flags impossible transaction status transitions
+// seen over time. It is safe for concurrent use.
+type TransactionStatusValidator struct {
+	mu       sync.Mutex
+	statuses map[string]TransactionStatus
+}
+
+// NewTransactionStatusValidator returns a new TransactionStatusValidator.
+func NewTransactionStatusValidator() *TransactionStatusValidator {
+	return &TransactionStatusValidator{statuses: make(map[string]TransactionStatus)}
+}
+
+// Observe records the status of the transaction. If the transaction cannot move
+// to the status from the previously observed one, a *TransitionError
+// is returned. The status is recorded either way.
+func (v *TransactionStatusValidator) Observe(id string, status TransactionStatus) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	prev, ok := v.statuses[id]
+	v.statuses[id] = status
+	if ok && !prev.CanTransitionTo(status) {
+		return &TransitionError{ID: id, From: string(prev), To: string(status)}
+	}
+
+	return nil
+}
+
+// Forget removes the transaction from the validator.
+func (v *TransactionStatusValidator) Forget(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.statuses, id)
+}
@@ -0,0 +1,133 @@
+package kunapay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInvoiceStatus(t *testing.T) {
+	tests := []struct {
+		status     InvoiceStatus
+		terminal   bool
+		successful bool
+	}{
+		{InvoiceStatusCreated, false, false},
+		{InvoiceStatusPaymentAwaiting, false, false},
+		{InvoiceStatusConfirmationAwaiting, false, false},
+		{InvoiceStatusPartiallyPaid, false, false},
+		{InvoiceStatusPaid, true, true},
+		{InvoiceStatusTimeout, true, false},
+		{InvoiceStatusDeactivated, true, false},
+		{InvoiceStatusDeclined, true, false},
+		{InvoiceStatusLimitsOutOfRange, true, false},
+	}
+
+	for _, test := range tests {
+		if got := test.status.IsTerminal(); got != test.terminal {
+			t.Errorf("%v.IsTerminal() = %v, want %v", test.status, got, test.terminal)
+		}
+		if got := test.status.IsSuccessful(); got != test.successful {
+			t.Errorf("%v.IsSuccessful() = %v, want %v", test.status, got, test.successful)
+		}
+	}
+
+	if InvoiceStatusConfirmetionAwaiting != InvoiceStatusConfirmationAwaiting {
+		t.Errorf("InvoiceStatusConfirmetionAwaiting = %v, want %v", InvoiceStatusConfirmetionAwaiting, InvoiceStatusConfirmationAwaiting)
+	}
+}
+
+func TestInvoiceStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to InvoiceStatus
+		want     bool
+	}{
+		{InvoiceStatusCreated, InvoiceStatusPaymentAwaiting, true},
+		{InvoiceStatusPaymentAwaiting, InvoiceStatusPaid, true},
+		{InvoiceStatusPartiallyPaid, InvoiceStatusPaid, true},
+		{InvoiceStatusPaid, InvoiceStatusPaid, true},
+		{InvoiceStatusPaid, InvoiceStatusPaymentAwaiting, false},
+		{InvoiceStatusTimeout, InvoiceStatusPaid, false},
+		{InvoiceStatusPaymentAwaiting, InvoiceStatusCreated, false},
+		{InvoiceStatus("NEW_STATUS"), InvoiceStatusCreated, true},
+	}
+
+	for _, test := range tests {
+		if got := test.from.CanTransitionTo(test.to); got != test.want {
+			t.Errorf("%v.CanTransitionTo(%v) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	tests := []struct {
+		status     TransactionStatus
+		terminal   bool
+		successful bool
+	}{
+		{TransactionStatusCreated, false, false},
+		{TransactionStatusProcessing, false, false},
+		{TransactionStatusProcessed, true, true},
+		{TransactionStatusPartiallyProcessed, true, true},
+		{TransactionStatusCanceled, true, false},
+	}
+
+	for _, test := range tests {
+		if got := test.status.IsTerminal(); got != test.terminal {
+			t.Errorf("%v.IsTerminal() = %v, want %v", test.status, got, test.terminal)
+		}
+		if got := test.status.IsSuccessful(); got != test.successful {
+			t.Errorf("%v.IsSuccessful() = %v, want %v", test.status, got, test.successful)
+		}
+	}
+
+	if !TransactionStatusProcessing.CanTransitionTo(TransactionStatusProcessed) {
+		t.Errorf("Processing.CanTransitionTo(Processed) = false, want true")
+	}
+	if TransactionStatusProcessed.CanTransitionTo(TransactionStatusProcessing) {
+		t.Errorf("Processed.CanTransitionTo(Processing) = true, want false")
+	}
+}
+
+func TestInvoiceStatusValidator_Observe(t *testing.T) {
+	v := NewInvoiceStatusValidator()
+
+	for _, status := range []InvoiceStatus{InvoiceStatusCreated, InvoiceStatusPaymentAwaiting, InvoiceStatusPaid} {
+		if err := v.Observe("invoice", status); err != nil {
+			t.Errorf("InvoiceStatusValidator.Observe(%v) returned error: %v", status, err)
+		}
+	}
+
+	err := v.Observe("invoice", InvoiceStatusPaymentAwaiting)
+	var transitionErr *TransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("InvoiceStatusValidator.Observe returned %v, want TransitionError", err)
+	}
+	want := TransitionError{ID: "invoice", From: "PAID", To: "PAYMENT_AWAITING"}
+	if *transitionErr != want {
+		t.Errorf("InvoiceStatusValidator.Observe returned %+v, want %+v", *transitionErr, want)
+	}
+
+	v.Forget("invoice")
+	if err := v.Observe("invoice", InvoiceStatusCreated); err != nil {
+		t.Errorf("InvoiceStatusValidator.Observe after Forget returned error: %v", err)
+	}
+}
+
+func TestTransactionStatusValidator_Observe(t *testing.T) {
+	v := NewTransactionStatusValidator()
+
+	if err := v.Observe("tx", TransactionStatusProcessing); err != nil {
+		t.Errorf("TransactionStatusValidator.Observe returned error: %v", err)
+	}
+	if err := v.Observe("tx", TransactionStatusCanceled); err != nil {
+		t.Errorf("TransactionStatusValidator.Observe returned error: %v", err)
+	}
+	if err := v.Observe("tx", TransactionStatusProcessed); err == nil {
+		t.Errorf("TransactionStatusValidator.Observe(Canceled -> Processed) returned nil, want error")
+	}
+
+	v.Forget("tx")
+	if err := v.Observe("tx", TransactionStatusCreated); err != nil {
+		t.Errorf("TransactionStatusValidator.Observe after Forget returned error: %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vorobeyme/kunapay-go/qr"
+)
+
+// DefaultStatusPageTemplate is the template of the invoice status page,
+// executed with *StatusPageData. It reloads the page when the status changes.
+const DefaultStatusPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Invoice {{.Invoice.ID}}</title>
+<style>
+body{font-family:sans-serif;max-width:28rem;margin:2rem auto;padding:0 1rem;text-align:center}
+.qr svg{width:16rem;height:16rem}
+.address{font-family:monospace;word-break:break-all}
+</style>
+</head>
+<body>
+<h1>{{.Invoice.InvoiceAmount}} {{.Invoice.InvoiceAssetCode}}</h1>
+{{with .Invoice.PaymentAmount}}<p>Pay {{.}} {{$.Invoice.PaymentAssetCode}}</p>{{end}}
+<p>Status: <strong id="status">{{.Invoice.Status}}</strong></p>
+{{if not .Terminal}}
+{{with .QRCode}}<div class="qr">{{.}}</div>{{end}}
+{{with .PaymentTarget}}<p class="address">{{.}}</p>{{end}}
+{{if not .ExpireAt.IsZero}}<p>Expires in <span id="countdown" data-expire-at="{{.ExpireAt.UnixMilli}}"></span></p>{{end}}
+<script>
+(function () {
+  var el = document.getElementById("countdown");
+  if (el) {
+    var expireAt = Number(el.dataset.expireAt);
+    var tick = function () {
+      var s = Math.max(0, Math.floor((expireAt - Date.now()) / 1000));
+      el.textContent = Math.floor(s / 60) + ":" + ("0" + s % 60).slice(-2);
+    };
+    tick();
+    setInterval(tick, 1000);
+  }
+  var status = {{.Invoice.Status}};
+  var events = new EventSource({{.EventsURL}});
+  events.addEventListener("status", function (e) {
+    if (JSON.parse(e.data).status !== status) {
+      window.location.reload();
+    }
+  });
+})();
+</script>
+{{end}}
+</body>
+</html>
+`
+
+// StatusPageOpts specifies the optional parameters to the StatusPage.
+type StatusPageOpts struct {
+	// Template overrides the DefaultStatusPageTemplate.
+	// It is executed with *StatusPageData.
+	Template *template.Template
+
+	// PaymentLink returns the payment link of the invoice, e.g. the
+	// CreateInvoiceResponse.PaymentLink stored when the invoice was created,
+	// since the invoice details do not include it. If it is nil or returns
+	// an empty link, the QR code encodes the deposit address of the invoice
+	// transactions, if any.
+	PaymentLink func(detail *InvoiceDetail) string
+
+	// QRLevel is the error correction level of the QR code. Defaults to qr.Medium.
+	QRLevel qr.Level
+
+	// KeepAlive is the interval of the comments sent on idle event streams,
+	// so proxies do not close them. Defaults to 15 seconds.
+	KeepAlive time.Duration
+}
+
+// StatusPageData is the data of the invoice status page template.
+type StatusPageData struct {
+	Invoice *InvoiceDetail
+
+	// PaymentTarget is the payment link or the deposit address of the invoice,
+	// empty if neither is known.
+	PaymentTarget string
+
+	// QRCode is the SVG QR code of the PaymentTarget, if any.
+	QRCode template.HTML
+
+	// ExpireAt is the expiration time of the invoice, zero if unknown.
+	ExpireAt time.Time
+
+	// Terminal reports whether the invoice is in a terminal status.
+	Terminal bool
+
+	// EventsURL is the URL of the status event stream, relative to the page.
+	EventsURL string
+}
+
+// StatusPageEvent is the data of the "status" events of the event stream.
+type StatusPageEvent struct {
+	InvoiceID      string        `json:"invoiceId"`
+	Status         InvoiceStatus `json:"status"`
+	PreviousStatus InvoiceStatus `json:"previousStatus,omitempty"`
+}
+
+// StatusPage is an http.Handler that serves the invoice status pages.
+//
+// GET /{id} renders the page of the invoice, and GET /{id}/events streams
+// its status changes as Server-Sent Events. Mount it with http.StripPrefix.
+// The status changes are pushed with HandleInvoiceEvent, e.g. by a Reconciler,
+// or with Publish as an EventSink of a Publisher.
+type StatusPage struct {
+	client *Client
+	opts   StatusPageOpts
+	tmpl   *template.Template
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan *StatusPageEvent]struct{}
+}
+
+// NewStatusPage returns a new StatusPage.
+func NewStatusPage(client *Client, opts *StatusPageOpts) *StatusPage {
+	o := StatusPageOpts{QRLevel: qr.Medium, KeepAlive: 15 * time.Second}
+	if opts != nil {
+		o.Template = opts.Template
+		o.PaymentLink = opts.PaymentLink
+		if opts.QRLevel != 0 {
+			o.QRLevel = opts.QRLevel
+		}
+		if opts.KeepAlive > 0 {
+			o.KeepAlive = opts.KeepAlive
+		}
+	}
+
+	tmpl := o.Template
+	if tmpl == nil {
+		tmpl = template.Must(template.New("status").Parse(DefaultStatusPageTemplate))
+	}
+
+	return &StatusPage{
+		client:      client,
+		opts:        o,
+		tmpl:        tmpl,
+		subscribers: make(map[string]map[chan *StatusPageEvent]struct{}),
+	}
+}
+
+// ServeHTTP serves the status page or the event stream of the invoice.
+func (p *StatusPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, events := strings.TrimPrefix(r.URL.Path, "/"), false
+	if strings.HasSuffix(id, "/events") {
+		id, events = strings.TrimSuffix(id, "/events"), true
+	}
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Subscribe before fetching the invoice, so no status change is missed.
+	var ch <-chan *StatusPageEvent
+	if events {
+		var unsubscribe func()
+		ch, unsubscribe = p.subscribe(id)
+		defer unsubscribe()
+	}
+
+	detail, _, err := p.client.Invoice.Get(r.Context(), id)
+	if err != nil {
+		var respErr *ResponseError
+		if errors.As(err, &respErr) && respErr.Response.StatusCode == http.StatusNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	if detail == nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	if events {
+		p.serveEvents(w, r, detail, ch)
+		return
+	}
+	p.servePage(w, detail)
+}
+
+// servePage renders the status page of the invoice.
+func (p *StatusPage) servePage(w http.ResponseWriter, detail *InvoiceDetail) {
+	data := &StatusPageData{
+		Invoice:   detail,
+		Terminal:  detail.Status.IsTerminal(),
+		EventsURL: url.PathEscape(detail.ID) + "/events",
+	}
+	if t, err := parseTime(detail.ExpireAt); err == nil {
+		data.ExpireAt = t
+	}
+	if data.PaymentTarget = p.paymentTarget(detail); data.PaymentTarget != "" {
+		if code, err := qr.Encode(data.PaymentTarget, p.opts.QRLevel); err == nil {
+			// The SVG is generated from the module grid only, so it is safe.
+			data.QRCode = template.HTML(code.SVG(&qr.Options{Margin: 4}))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := p.tmpl.Execute(w, data); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// paymentTarget returns the payment link of the invoice, or the deposit
+// address of its last listed deposit transaction.
+func (p *StatusPage) paymentTarget(detail *InvoiceDetail) string {
+	if p.opts.PaymentLink != nil {
+		if link := p.opts.PaymentLink(detail); link != "" {
+			return link
+		}
+	}
+	for i := len(detail.Transactions) - 1; i >= 0; i-- {
+		if tx := detail.Transactions[i]; tx.Type == TransactionTypeDeposit && tx.Address != "" {
+			return tx.Address
+		}
+	}
+
+	return ""
+}
+
+// serveEvents streams the status changes of the invoice until it reaches
+// a terminal status or the client disconnects. The current status is sent first.
+func (p *StatusPage) serveEvents(w http.ResponseWriter, r *http.Request, detail *InvoiceDetail, ch <-chan *StatusPageEvent) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e *StatusPageEvent) bool {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return !e.Status.IsTerminal()
+	}
+
+	if !send(&StatusPageEvent{InvoiceID: detail.ID, Status: detail.Status}) {
+		return
+	}
+
+	keepAlive := time.NewTicker(p.opts.KeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e := <-ch:
+			if !send(e) {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// subscribe registers a stream of the invoice status changes.
+func (p *StatusPage) subscribe(id string) (<-chan *StatusPageEvent, func()) {
+	ch := make(chan *StatusPageEvent, 1)
+
+	p.mu.Lock()
+	if p.subscribers[id] == nil {
+		p.subscribers[id] = make(map[chan *StatusPageEvent]struct{})
+	}
+	p.subscribers[id][ch] = struct{}{}
+	p.mu.Unlock()
+
+	return ch, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		delete(p.subscribers[id], ch)
+		if len(p.subscribers[id]) == 0 {
+			delete(p.subscribers, id)
+		}
+	}
+}
+
+// push sends the status change to the streams of the invoice. A stream that
+// has not received the previous change yet gets only the latest one.
+func (p *StatusPage) push(e *StatusPageEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ch := range p.subscribers[e.InvoiceID] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- e
+	}
+}
+
+// HandleInvoiceEvent pushes the invoice status change to the open status pages.
+// It is an InvoiceHandler, so it can be used with the Reconciler.
+func (p *StatusPage) HandleInvoiceEvent(_ context.Context, e *InvoiceEvent) error {
+	p.push(&StatusPageEvent{InvoiceID: e.InvoiceID, Status: e.Status, PreviousStatus: e.PreviousStatus})
+	return nil
+}
+
+// Publish pushes the invoice status change event to the open status pages.
+// It implements EventSink, other events are ignored.
+func (p *StatusPage) Publish(_ context.Context, e *Event) error {
+	if e.Kind != EventInvoiceStatusChanged {
+		return nil
+	}
+	p.push(&StatusPageEvent{
+		InvoiceID:      e.ObjectID,
+		Status:         InvoiceStatus(e.Status),
+		PreviousStatus: InvoiceStatus(e.PreviousStatus),
+	})
+
+	return nil
+}
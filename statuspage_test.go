@@ -0,0 +1,212 @@
+package kunapay
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vorobeyme/kunapay-go/qr"
+)
+
+func setupStatusPage(t *testing.T, opts *StatusPageOpts) (*StatusPage, *httptest.Server, func()) {
+	client, mux, teardown := setupClient()
+
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/invoice/open":
+			fmt.Fprint(w, `{"data":{"id":"open","status":"PAYMENT_AWAITING","addressId":"b2c6e1a0-5d1f-4f7e-9c7a-2f6d8e1b3a44","invoiceAmount":"100.5","invoiceAssetCode":"USDT","expireAt":"2099-01-01T00:00:00.000Z",`+
+				`"transactions":[{"id":"1","type":"Deposit","status":"Processing","address":"tb1q0xrgwsd7e0uad3sy98klppjwjq26023mcx224d"}]}}`)
+		case "/v1/invoice/paid":
+			fmt.Fprint(w, `{"data":{"id":"paid","status":"PAID","invoiceAmount":"1","invoiceAssetCode":"USDT"}}`)
+		case "/v1/invoice/broken":
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		case "/v1/invoice/empty":
+			fmt.Fprint(w, `{"data":null}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	page := NewStatusPage(client, opts)
+	server := httptest.NewServer(http.StripPrefix("/pay", page))
+
+	return page, server, func() {
+		server.Close()
+		teardown()
+	}
+}
+
+func TestStatusPage_page(t *testing.T) {
+	_, server, teardown := setupStatusPage(t, nil)
+	defer teardown()
+
+	resp, err := http.Get(server.URL + "/pay/open")
+	if err != nil {
+		t.Fatalf("GET returned error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET returned status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	for _, want := range []string{
+		"100.5 USDT",
+		"PAYMENT_AWAITING",
+		"<svg",
+		"tb1q0xrgwsd7e0uad3sy98klppjwjq26023mcx224d",
+		`data-expire-at="4070908800000"`,
+		`new EventSource("open/events")`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("StatusPage page does not contain %s", want)
+		}
+	}
+	if strings.Contains(string(body), "b2c6e1a0-5d1f-4f7e-9c7a-2f6d8e1b3a44") {
+		t.Errorf("StatusPage page contains the address ID")
+	}
+}
+
+func TestStatusPage_paymentLink(t *testing.T) {
+	page, server, teardown := setupStatusPage(t, &StatusPageOpts{
+		PaymentLink: func(detail *InvoiceDetail) string { return "https://example.com/invoice/" + detail.ID },
+	})
+	defer teardown()
+
+	if page.opts.QRLevel != qr.Medium {
+		t.Errorf("StatusPage QR level is %d, want %d", page.opts.QRLevel, qr.Medium)
+	}
+
+	resp, err := http.Get(server.URL + "/pay/open")
+	if err != nil {
+		t.Fatalf("GET returned error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(body), "https://example.com/invoice/open") {
+		t.Errorf("StatusPage page does not contain the payment link")
+	}
+}
+
+func TestStatusPage_errors(t *testing.T) {
+	_, server, teardown := setupStatusPage(t, nil)
+	defer teardown()
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/pay/missing", http.StatusNotFound},
+		{http.MethodGet, "/pay/broken", http.StatusBadGateway},
+		{http.MethodGet, "/pay/empty", http.StatusBadGateway},
+		{http.MethodGet, "/pay/empty/events", http.StatusBadGateway},
+		{http.MethodGet, "/pay/", http.StatusNotFound},
+		{http.MethodGet, "/pay/a/b", http.StatusNotFound},
+		{http.MethodPost, "/pay/open", http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, server.URL+test.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s returned error: %v", test.method, test.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("%s %s returned status %d, want %d", test.method, test.path, resp.StatusCode, test.want)
+		}
+	}
+}
+
+func TestStatusPage_template(t *testing.T) {
+	tmpl := template.Must(template.New("custom").Parse(`{{.Invoice.ID}} is {{.Invoice.Status}}, terminal {{.Terminal}}`))
+	_, server, teardown := setupStatusPage(t, &StatusPageOpts{Template: tmpl})
+	defer teardown()
+
+	resp, err := http.Get(server.URL + "/pay/paid")
+	if err != nil {
+		t.Fatalf("GET returned error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if want := "paid is PAID, terminal true"; string(body) != want {
+		t.Errorf("StatusPage page is %q, want %q", body, want)
+	}
+}
+
+func TestStatusPage_events(t *testing.T) {
+	page, server, teardown := setupStatusPage(t, &StatusPageOpts{KeepAlive: 10 * time.Millisecond})
+	defer teardown()
+
+	resp, err := http.Get(server.URL + "/pay/open/events")
+	if err != nil {
+		t.Fatalf("GET returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("StatusPage events Content-Type is %s, want text/event-stream", got)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "data: ") {
+				lines <- strings.TrimPrefix(scanner.Text(), "data: ")
+			}
+		}
+	}()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("StatusPage events timed out")
+			return ""
+		}
+	}
+
+	if got, want := next(), `{"invoiceId":"open","status":"PAYMENT_AWAITING"}`; got != want {
+		t.Errorf("StatusPage first event is %s, want %s", got, want)
+	}
+
+	_ = page.HandleInvoiceEvent(context.Background(), &InvoiceEvent{InvoiceID: "other", Status: InvoiceStatusPaid})
+	_ = page.Publish(context.Background(), &Event{Kind: EventWithdrawStatusChanged, ObjectID: "open", Status: "PROCESSED"})
+	_ = page.HandleInvoiceEvent(context.Background(), &InvoiceEvent{
+		InvoiceID:      "open",
+		PreviousStatus: InvoiceStatusPaymentAwaiting,
+		Status:         InvoiceStatusConfirmationAwaiting,
+	})
+	if got, want := next(), `{"invoiceId":"open","status":"CONFIRMATION_AWAITING","previousStatus":"PAYMENT_AWAITING"}`; got != want {
+		t.Errorf("StatusPage event is %s, want %s", got, want)
+	}
+
+	_ = page.Publish(context.Background(), &Event{Kind: EventInvoiceStatusChanged, ObjectID: "open", Status: "PAID", PreviousStatus: "CONFIRMATION_AWAITING"})
+	if got, want := next(), `{"invoiceId":"open","status":"PAID","previousStatus":"CONFIRMATION_AWAITING"}`; got != want {
+		t.Errorf("StatusPage event is %s, want %s", got, want)
+	}
+
+	// The stream ends after the terminal status.
+	if _, ok := <-lines; ok {
+		t.Errorf("StatusPage events stream is open after terminal status")
+	}
+	page.mu.Lock()
+	n := len(page.subscribers)
+	page.mu.Unlock()
+	if n != 0 {
+		t.Errorf("StatusPage has %d subscribed invoices, want 0", n)
+	}
+}
@@ -0,0 +1,219 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TransactionEvent is a new transaction or a status change of a known one.
+type TransactionEvent struct {
+	Transaction *Transaction
+
+	// PreviousStatus is empty for a new transaction.
+	PreviousStatus TransactionStatus
+
+	// Cursor resumes the stream right after this event.
+	Cursor string
+}
+
+// TransactionStreamOpts specifies the optional parameters to the
+// TransactionService.Stream method.
+type TransactionStreamOpts struct {
+	// Interval between the polls. Defaults to 10 seconds.
+	Interval time.Duration
+
+	// Overlap is how far before the latest transaction the transactions are
+	// listed again, to catch the ones that appear in the list late.
+	// Defaults to 10 minutes.
+	Overlap time.Duration
+
+	// Since is the creation time of the first streamed transaction when
+	// there is no cursor. By default all transactions are streamed.
+	Since time.Time
+
+	// Asset limits the streamed transactions to the asset.
+	Asset string
+
+	// Cursor resumes the stream after the event it was taken from.
+	Cursor string
+
+	// MaxTracked is the number of transactions whose status is tracked.
+	// When there are more, the oldest ones are dropped and their later
+	// status changes are not emitted. Defaults to 10000.
+	MaxTracked int
+
+	// OnError is called when the transactions cannot be listed.
+	// They are listed again after the interval.
+	OnError func(err error)
+}
+
+// Stream polls the transactions ordered by creation time and emits the new ones
+// and the status changes of the ones created within the overlap window or not
+// in a terminal status yet. The events of a poll are emitted in order, and the
+// next poll starts only after they are received, so a slow consumer holds the
+// polling back. The channel is closed when the context is done.
+//
+// Store the cursor of the last handled event and pass it in the options to
+// restart the stream without gaps. The cursor is a position in the creation
+// order, so the restarted stream emits the transactions created after it,
+// and the status changes of the earlier ones from its first poll on.
+func (s *TransactionService) Stream(ctx context.Context, opts *TransactionStreamOpts) (<-chan *TransactionEvent, error) {
+	o := TransactionStreamOpts{Interval: 10 * time.Second, MaxTracked: 10000}
+	if opts != nil {
+		o = *opts
+		if o.Interval <= 0 {
+			o.Interval = 10 * time.Second
+		}
+		if o.MaxTracked <= 0 {
+			o.MaxTracked = 10000
+		}
+	}
+
+	checkpoint := &Checkpoint{Transactions: make(map[string]CheckpointTransaction)}
+	var seen streamPosition
+	if o.Cursor != "" {
+		if err := seen.decode(o.Cursor); err != nil {
+			return nil, err
+		}
+		checkpoint.CreatedAt = seen.CreatedAt
+	}
+
+	syncer := NewTransactionSyncer(s.client, nil, &TransactionSyncerOpts{
+		Overlap: o.Overlap,
+		Since:   o.Since,
+		Asset:   o.Asset,
+	})
+
+	events := make(chan *TransactionEvent)
+	go func() {
+		defer close(events)
+
+		// last is the position of the latest scanned transaction.
+		last := seen
+		for {
+			err := syncer.scan(ctx, checkpoint, func(tx *Transaction, previous TransactionStatus) error {
+				createdAt := checkpoint.Transactions[tx.ID].CreatedAt
+				last.advance(tx.ID, createdAt)
+
+				// An untracked transaction up to the seen position was
+				// emitted before, so it is only tracked again.
+				if previous == "" && seen.covers(tx.ID, createdAt) {
+					return nil
+				}
+				select {
+				case events <- &TransactionEvent{Transaction: tx, PreviousStatus: previous, Cursor: last.encode()}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && o.OnError != nil {
+				o.OnError(err)
+			}
+			seen.prune(syncer, checkpoint, o.MaxTracked)
+
+			timer := time.NewTimer(o.Interval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// streamPosition is a position in the creation order of the transactions:
+// the creation time of the latest transaction and the IDs of the ones created
+// at that time. It is encoded in the cursors.
+type streamPosition struct {
+	CreatedAt time.Time `json:"createdAt"`
+	IDs       []string  `json:"ids,omitempty"`
+}
+
+// advance moves the position to the transaction if it is not older.
+func (p *streamPosition) advance(id string, createdAt time.Time) {
+	switch {
+	case createdAt.After(p.CreatedAt):
+		p.CreatedAt, p.IDs = createdAt, []string{id}
+	case createdAt.Equal(p.CreatedAt) && !p.covers(id, createdAt):
+		p.IDs = append(p.IDs, id)
+	}
+}
+
+// covers reports whether the transaction is at or before the position.
+func (p *streamPosition) covers(id string, createdAt time.Time) bool {
+	if !createdAt.Equal(p.CreatedAt) {
+		return createdAt.Before(p.CreatedAt)
+	}
+	for _, seen := range p.IDs {
+		if seen == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prune drops the transactions that will not be listed again and then the
+// oldest ones until at most limit are left from the checkpoint, and moves the
+// position past them, so they are not emitted as new when listed again.
+func (p *streamPosition) prune(syncer *TransactionSyncer, checkpoint *Checkpoint, limit int) {
+	ids := make([]string, 0, len(checkpoint.Transactions))
+	for id, tx := range checkpoint.Transactions {
+		if syncer.expired(checkpoint, tx) {
+			p.drop(checkpoint, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) <= limit {
+		return
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := checkpoint.Transactions[ids[i]].CreatedAt, checkpoint.Transactions[ids[j]].CreatedAt
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids[:len(ids)-limit] {
+		p.drop(checkpoint, id)
+	}
+}
+
+// drop deletes the transaction from the checkpoint and moves the position
+// past it.
+func (p *streamPosition) drop(checkpoint *Checkpoint, id string) {
+	p.advance(id, checkpoint.Transactions[id].CreatedAt)
+	delete(checkpoint.Transactions, id)
+}
+
+// encode returns the position as a cursor.
+func (p *streamPosition) encode() string {
+	data, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decode sets the position from the cursor.
+func (p *streamPosition) decode(cursor string) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return fmt.Errorf("decode cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return fmt.Errorf("decode cursor: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransactionService_Stream(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var (
+		mu           sync.Mutex
+		transactions []string
+		fail         bool
+	)
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(transactions, ","))
+	})
+	set := func(txs ...string) {
+		mu.Lock()
+		transactions = txs
+		mu.Unlock()
+	}
+	tx := func(id string, status TransactionStatus, createdAt string) string {
+		return fmt.Sprintf(`{"id":%q,"status":%q,"createdAt":%q}`, id, status, createdAt)
+	}
+	receive := func(events <-chan *TransactionEvent, n int) ([]string, []*TransactionEvent) {
+		t.Helper()
+		var got []string
+		var received []*TransactionEvent
+		for i := 0; i < n; i++ {
+			select {
+			case e := <-events:
+				got = append(got, fmt.Sprintf("%s:%s->%s", e.Transaction.ID, e.PreviousStatus, e.Transaction.Status))
+				received = append(received, e)
+			case <-time.After(time.Second):
+				t.Fatalf("TransactionService.Stream emitted %v, want %d events", got, n)
+			}
+		}
+		return got, received
+	}
+
+	set(
+		tx("a", TransactionStatusProcessed, "2023-07-02T10:00:00.000Z"),
+		tx("b", TransactionStatusProcessing, "2023-07-02T11:00:00.000Z"),
+	)
+
+	var errs []error
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := client.Transaction.Stream(ctx, &TransactionStreamOpts{
+		Interval: 5 * time.Millisecond,
+		Overlap:  2 * time.Hour,
+		OnError:  func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatalf("TransactionService.Stream returned error: %v", err)
+	}
+
+	got, first := receive(events, 2)
+	if want := "a:->Processed b:->Processing"; strings.Join(got, " ") != want {
+		t.Errorf("TransactionService.Stream emitted %v, want %s", got, want)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	set(
+		tx("a", TransactionStatusProcessed, "2023-07-02T10:00:00.000Z"),
+		tx("b", TransactionStatusProcessed, "2023-07-02T11:00:00.000Z"),
+		tx("c", TransactionStatusCreated, "2023-07-02T12:00:00.000Z"),
+	)
+	got, _ = receive(events, 2)
+	if want := "b:Processing->Processed c:->Created"; strings.Join(got, " ") != want {
+		t.Errorf("TransactionService.Stream emitted %v, want %s", got, want)
+	}
+
+	cancel()
+	for range events {
+	}
+	if len(errs) != 1 {
+		t.Errorf("TransactionService.Stream reported errors %v, want one", errs)
+	}
+
+	// Resuming after the first event emits everything after it.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	events, err = client.Transaction.Stream(ctx, &TransactionStreamOpts{Overlap: 2 * time.Hour, Cursor: first[0].Cursor})
+	if err != nil {
+		t.Fatalf("TransactionService.Stream returned error: %v", err)
+	}
+	got, _ = receive(events, 2)
+	if want := "b:->Processed c:->Created"; strings.Join(got, " ") != want {
+		t.Errorf("resumed TransactionService.Stream emitted %v, want %s", got, want)
+	}
+}
+
+func TestTransactionService_StreamMaxTracked(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var (
+		mu     sync.Mutex
+		status = [3]TransactionStatus{TransactionStatusCreated, TransactionStatusCreated, TransactionStatusCreated}
+	)
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `{"data":[
+			{"id":"c","status":%q,"createdAt":"2023-07-02T11:00:00.000Z"},
+			{"id":"b","status":%q,"createdAt":"2023-07-02T10:00:00.000Z"},
+			{"id":"a","status":%q,"createdAt":"2023-07-02T10:00:00.000Z"}
+		]}`, status[2], status[1], status[0])
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := client.Transaction.Stream(ctx, &TransactionStreamOpts{Interval: 5 * time.Millisecond, MaxTracked: 2})
+	if err != nil {
+		t.Fatalf("TransactionService.Stream returned error: %v", err)
+	}
+
+	var got []string
+	var last *TransactionEvent
+	for i := 0; i < 4; i++ {
+		if i == 3 {
+			// Only b and c are tracked, so the status change of a is
+			// not emitted and a is not emitted as new either.
+			mu.Lock()
+			status = [3]TransactionStatus{TransactionStatusProcessed, TransactionStatusProcessed, TransactionStatusCreated}
+			mu.Unlock()
+		}
+		select {
+		case e := <-events:
+			got = append(got, fmt.Sprintf("%s:%s->%s", e.Transaction.ID, e.PreviousStatus, e.Transaction.Status))
+			last = e
+		case <-time.After(time.Second):
+			t.Fatalf("TransactionService.Stream emitted %v, want 4 events", got)
+		}
+	}
+	if want := "a:->Created b:->Created c:->Created b:Created->Processed"; strings.Join(got, " ") != want {
+		t.Errorf("TransactionService.Stream emitted %v, want %s", got, want)
+	}
+
+	// The cursor holds the latest position, not the tracked transactions.
+	data, _ := base64.RawURLEncoding.DecodeString(last.Cursor)
+	if want := `{"createdAt":"2023-07-02T11:00:00Z","ids":["c"]}`; string(data) != want {
+		t.Errorf("TransactionEvent.Cursor is %s, want %s", data, want)
+	}
+}
+
+func TestTransactionService_StreamInvalidCursor(t *testing.T) {
+	client, _, teardown := setupClient()
+	defer teardown()
+
+	// The second cursor is "not json" encoded.
+	for _, cursor := range []string{"!", "bm90IGpzb24"} {
+		if _, err := client.Transaction.Stream(context.Background(), &TransactionStreamOpts{Cursor: cursor}); err == nil {
+			t.Errorf("TransactionService.Stream with cursor %q returned nil, want error", cursor)
+		}
+	}
+}
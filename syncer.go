@@ -0,0 +1,330 @@
+package kunapay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the progress of the TransactionSyncer.
+type Checkpoint struct {
+	// CreatedAt is the creation time of the latest synced transaction.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Transactions are the synced transactions that can be listed again:
+	// the ones created within the overlap window before CreatedAt, and
+	// the ones that are not in a terminal status yet.
+	Transactions map[string]CheckpointTransaction `json:"transactions"`
+}
+
+// CheckpointTransaction is the state of a synced transaction.
+type CheckpointTransaction struct {
+	Status    TransactionStatus `json:"status"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// CheckpointStore persists the checkpoint of the TransactionSyncer.
+type CheckpointStore interface {
+	// Load returns the saved checkpoint, or nil if there is none.
+	Load(ctx context.Context) (*Checkpoint, error)
+
+	// Save saves the checkpoint.
+	Save(ctx context.Context, checkpoint *Checkpoint) error
+}
+
+// MemoryCheckpointStore keeps the checkpoint in memory.
+type MemoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint []byte
+}
+
+// NewMemoryCheckpointStore returns a new MemoryCheckpointStore.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{}
+}
+
+// Load returns a copy of the saved checkpoint.
+func (s *MemoryCheckpointStore) Load(_ context.Context) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.checkpoint == nil {
+		return nil, nil
+	}
+
+	return decodeCheckpoint(s.checkpoint)
+}
+
+// Save saves a copy of the checkpoint.
+func (s *MemoryCheckpointStore) Save(_ context.Context, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.checkpoint = data
+	s.mu.Unlock()
+
+	return nil
+}
+
+// FileCheckpointStore keeps the checkpoint in a JSON file.
+type FileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore returns a new FileCheckpointStore that keeps the checkpoint
+// in the file. The file is replaced atomically, so a crash during Save leaves
+// the previous checkpoint intact.
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load reads the checkpoint from the file. It returns nil if the file does not exist.
+func (s *FileCheckpointStore) Load(_ context.Context) (*Checkpoint, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCheckpoint(data)
+}
+
+// Save writes the checkpoint to a temporary file and renames it over the file.
+func (s *FileCheckpointStore) Save(_ context.Context, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+func decodeCheckpoint(data []byte) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// TransactionHandler handles a new transaction or a status change of a synced one.
+// The previous status is empty for a new transaction.
+type TransactionHandler func(ctx context.Context, tx *Transaction, previous TransactionStatus) error
+
+// TransactionSyncerOpts specifies the optional parameters to the TransactionSyncer.
+type TransactionSyncerOpts struct {
+	// Overlap is how far before the checkpoint the transactions are listed again,
+	// to catch the ones that appear in the list late. Defaults to 10 minutes.
+	Overlap time.Duration
+
+	// Since is the creation time of the first synced transaction when there is
+	// no checkpoint yet. By default all transactions are synced.
+	Since time.Time
+
+	// Asset limits the synced transactions to the asset.
+	Asset string
+}
+
+// TransactionSyncer mirrors the transactions incrementally. Each Sync lists
+// the transactions created since the checkpoint, minus the overlap window,
+// and since the oldest synced transaction that is not in a terminal status,
+// so its later status changes are caught too.
+type TransactionSyncer struct {
+	client *Client
+	store  CheckpointStore
+	opts   TransactionSyncerOpts
+
+	// mu serializes the syncs.
+	mu sync.Mutex
+}
+
+// NewTransactionSyncer returns a new TransactionSyncer.
+func NewTransactionSyncer(client *Client, store CheckpointStore, opts *TransactionSyncerOpts) *TransactionSyncer {
+	o := TransactionSyncerOpts{Overlap: 10 * time.Minute}
+	if opts != nil {
+		if opts.Overlap > 0 {
+			o.Overlap = opts.Overlap
+		}
+		o.Since = opts.Since
+		o.Asset = opts.Asset
+	}
+
+	return &TransactionSyncer{client: client, store: store, opts: o}
+}
+
+// Sync calls the handler for every new transaction and for every synced one
+// whose status changed, and returns the number of handled transactions.
+// The checkpoint is saved only after all transactions are handled, so if
+// the handler fails, the same transactions are handled again on the next Sync.
+func (s *TransactionSyncer) Sync(ctx context.Context, handler TransactionHandler) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, err := s.store.Load(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("load checkpoint: %w", err)
+	}
+	if checkpoint == nil {
+		checkpoint = &Checkpoint{}
+	}
+	if checkpoint.Transactions == nil {
+		checkpoint.Transactions = make(map[string]CheckpointTransaction)
+	}
+
+	var n int
+	err = s.scan(ctx, checkpoint, func(tx *Transaction, previous TransactionStatus) error {
+		n++
+		return handler(ctx, tx, previous)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	s.prune(checkpoint)
+	if err := s.store.Save(ctx, checkpoint); err != nil {
+		return n, fmt.Errorf("save checkpoint: %w", err)
+	}
+
+	return n, nil
+}
+
+// scan lists the transactions since the checkpoint and calls emit for the new
+// and changed ones, oldest first. The listing does not rely on the order of the
+// API: the pages are deduplicated by ID, the transactions created before the
+// start are dropped and the result is sorted by creation time. It updates the
+// checkpoint in place before each emit, so the checkpoint passed to emit
+// already includes the transaction.
+func (s *TransactionSyncer) scan(ctx context.Context, checkpoint *Checkpoint, emit func(tx *Transaction, previous TransactionStatus) error) error {
+	opts := &TransactionListOpts{
+		Take:    invoiceListPageSize,
+		Asset:   s.opts.Asset,
+		OrderBy: TransactionOrderByCreatedAt,
+	}
+	from := s.from(checkpoint)
+	if !from.IsZero() {
+		opts.CreatedFrom = &from
+	}
+
+	var listed []*Transaction
+	index := make(map[string]int)
+	createdAt := make(map[string]time.Time)
+	for {
+		txs, _, err := s.client.Transaction.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		var first, last time.Time
+		for i, tx := range txs {
+			t, err := parseTime(tx.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("transaction %s: %w", tx.ID, err)
+			}
+			if i == 0 {
+				first = t
+			}
+			last = t
+			if t.Before(from) {
+				continue
+			}
+			// A page shifted by new transactions lists some of them again;
+			// the latest listing has the latest status.
+			if j, ok := index[tx.ID]; ok {
+				listed[j] = tx
+				continue
+			}
+			index[tx.ID] = len(listed)
+			createdAt[tx.ID] = t
+			listed = append(listed, tx)
+		}
+		// Newest first, the next pages are older than the last transaction.
+		if len(txs) < invoiceListPageSize || (first.After(last) && last.Before(from)) {
+			break
+		}
+		opts.Skip += invoiceListPageSize
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		ti, tj := createdAt[listed[i].ID], createdAt[listed[j].ID]
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return listed[i].ID < listed[j].ID
+	})
+
+	for _, tx := range listed {
+		prev, seen := checkpoint.Transactions[tx.ID]
+		if seen && prev.Status == tx.Status {
+			continue
+		}
+
+		t := createdAt[tx.ID]
+		checkpoint.Transactions[tx.ID] = CheckpointTransaction{Status: tx.Status, CreatedAt: t}
+		if t.After(checkpoint.CreatedAt) {
+			checkpoint.CreatedAt = t
+		}
+		if err := emit(tx, prev.Status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// from returns the creation time to list the transactions from.
+func (s *TransactionSyncer) from(checkpoint *Checkpoint) time.Time {
+	if checkpoint.CreatedAt.IsZero() {
+		return s.opts.Since
+	}
+
+	from := checkpoint.CreatedAt.Add(-s.opts.Overlap)
+	for _, tx := range checkpoint.Transactions {
+		if !tx.Status.IsTerminal() && tx.CreatedAt.Before(from) {
+			from = tx.CreatedAt
+		}
+	}
+
+	return from
+}
+
+// prune drops the transactions that will not be listed again from the checkpoint.
+func (s *TransactionSyncer) prune(checkpoint *Checkpoint) {
+	for id, tx := range checkpoint.Transactions {
+		if s.expired(checkpoint, tx) {
+			delete(checkpoint.Transactions, id)
+		}
+	}
+}
+
+// expired reports whether the transaction will not be listed again.
+func (s *TransactionSyncer) expired(checkpoint *Checkpoint, tx CheckpointTransaction) bool {
+	return tx.Status.IsTerminal() && tx.CreatedAt.Before(checkpoint.CreatedAt.Add(-s.opts.Overlap))
+}
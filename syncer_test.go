@@ -0,0 +1,219 @@
+package kunapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckpointStores(t *testing.T) {
+	checkpoint := &Checkpoint{
+		CreatedAt: time.Date(2023, 7, 30, 12, 0, 0, 0, time.UTC),
+		Transactions: map[string]CheckpointTransaction{
+			"tx": {Status: TransactionStatusProcessing, CreatedAt: time.Date(2023, 7, 30, 11, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	stores := map[string]CheckpointStore{
+		"memory": NewMemoryCheckpointStore(),
+		"file":   NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json")),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			got, err := store.Load(ctx)
+			if err != nil || got != nil {
+				t.Fatalf("Load of empty store returned %+v, %v, want nil", got, err)
+			}
+			if err := store.Save(ctx, checkpoint); err != nil {
+				t.Fatalf("Save returned error: %v", err)
+			}
+			got, err = store.Load(ctx)
+			if err != nil {
+				t.Fatalf("Load returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, checkpoint) {
+				t.Errorf("Load returned %+v, want %+v", got, checkpoint)
+			}
+		})
+	}
+}
+
+func TestFileCheckpointStore_errors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoint.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileCheckpointStore(path).Load(context.Background()); err == nil {
+		t.Errorf("FileCheckpointStore.Load of invalid file returned nil, want error")
+	}
+	if err := NewFileCheckpointStore(filepath.Join(dir, "missing", "checkpoint.json")).Save(context.Background(), &Checkpoint{}); err == nil {
+		t.Errorf("FileCheckpointStore.Save to missing directory returned nil, want error")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("FileCheckpointStore left %d files, want 1", len(entries))
+	}
+}
+
+func TestTransactionSyncer_Sync(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var transactions []string
+	var gotURL string
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		gotURL = r.RequestURI
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(transactions, ","))
+	})
+	tx := func(id string, status TransactionStatus, createdAt string) string {
+		return fmt.Sprintf(`{"id":%q,"status":%q,"createdAt":%q}`, id, status, createdAt)
+	}
+
+	store := NewMemoryCheckpointStore()
+	syncer := NewTransactionSyncer(client, store, &TransactionSyncerOpts{
+		Overlap: time.Hour,
+		Since:   time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC),
+		Asset:   "USDT",
+	})
+
+	var got []string
+	handler := func(_ context.Context, tx *Transaction, previous TransactionStatus) error {
+		got = append(got, fmt.Sprintf("%s:%s->%s", tx.ID, previous, tx.Status))
+		return nil
+	}
+
+	transactions = []string{
+		tx("old", TransactionStatusProcessing, "2023-07-01T08:00:00.000Z"),
+		tx("a", TransactionStatusProcessed, "2023-07-02T10:00:00.000Z"),
+		tx("b", TransactionStatusCreated, "2023-07-02T11:00:00.000Z"),
+		tx("a", TransactionStatusProcessed, "2023-07-02T10:00:00.000Z"),
+	}
+	n, err := syncer.Sync(context.Background(), handler)
+	if err != nil {
+		t.Fatalf("TransactionSyncer.Sync returned error: %v", err)
+	}
+	if want := "/v1/transaction?asset=USDT&createdFrom=2023-07-01T00%3A00%3A00Z&orderBy=createdAt&take=100"; gotURL != want {
+		t.Errorf("TransactionSyncer.Sync requested %s, want %s", gotURL, want)
+	}
+	if want := []string{"old:->Processing", "a:->Processed", "b:->Created"}; n != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("TransactionSyncer.Sync handled %d %v, want %v", n, got, want)
+	}
+
+	got = nil
+	transactions = []string{
+		tx("old", TransactionStatusProcessed, "2023-07-01T08:00:00.000Z"),
+		tx("a", TransactionStatusProcessed, "2023-07-02T10:00:00.000Z"),
+		tx("b", TransactionStatusProcessing, "2023-07-02T11:00:00.000Z"),
+		tx("c", TransactionStatusProcessed, "2023-07-02T12:00:00.000Z"),
+	}
+	if _, err := syncer.Sync(context.Background(), handler); err != nil {
+		t.Fatalf("TransactionSyncer.Sync returned error: %v", err)
+	}
+	// The pending transaction "old" is older than the overlap window.
+	if want := "/v1/transaction?asset=USDT&createdFrom=2023-07-01T08%3A00%3A00Z&orderBy=createdAt&take=100"; gotURL != want {
+		t.Errorf("TransactionSyncer.Sync requested %s, want %s", gotURL, want)
+	}
+	if want := []string{"old:Processing->Processed", "b:Created->Processing", "c:->Processed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TransactionSyncer.Sync handled %v, want %v", got, want)
+	}
+
+	checkpoint, _ := store.Load(context.Background())
+	if want := time.Date(2023, 7, 2, 12, 0, 0, 0, time.UTC); !checkpoint.CreatedAt.Equal(want) {
+		t.Errorf("Checkpoint.CreatedAt is %v, want %v", checkpoint.CreatedAt, want)
+	}
+	var ids []string
+	for id := range checkpoint.Transactions {
+		ids = append(ids, id)
+	}
+	if len(ids) != 2 || checkpoint.Transactions["b"].Status != TransactionStatusProcessing {
+		t.Errorf("Checkpoint.Transactions has %v, want b and c", checkpoint.Transactions)
+	}
+}
+
+func TestTransactionSyncer_SyncHandlerError(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"id":"a","status":"Processed","createdAt":"2023-07-02T10:00:00.000Z"}]}`)
+	})
+
+	store := NewMemoryCheckpointStore()
+	syncer := NewTransactionSyncer(client, store, nil)
+
+	handlerErr := errors.New("warehouse is down")
+	_, err := syncer.Sync(context.Background(), func(context.Context, *Transaction, TransactionStatus) error {
+		return handlerErr
+	})
+	if !errors.Is(err, handlerErr) {
+		t.Errorf("TransactionSyncer.Sync returned error %v, want %v", err, handlerErr)
+	}
+	if checkpoint, _ := store.Load(context.Background()); checkpoint != nil {
+		t.Errorf("TransactionSyncer.Sync saved checkpoint %+v after handler error", checkpoint)
+	}
+
+	n, err := syncer.Sync(context.Background(), func(context.Context, *Transaction, TransactionStatus) error { return nil })
+	if err != nil || n != 1 {
+		t.Errorf("TransactionSyncer.Sync returned %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestTransactionSyncer_SyncNewestFirst(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	tx := func(i int) string {
+		return fmt.Sprintf(`{"id":"%03d","status":"Processed","createdAt":%q}`, i, start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339Nano))
+	}
+
+	// 150 transactions newest first, and one more is created after the first
+	// page, which shifts the second page by one.
+	var transactions []string
+	for i := 149; i >= 0; i-- {
+		transactions = append(transactions, tx(i))
+	}
+	var requests int
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests == 2 {
+			transactions = append([]string{tx(150)}, transactions...)
+		}
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		page := transactions[skip:]
+		if len(page) > invoiceListPageSize {
+			page = page[:invoiceListPageSize]
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(page, ","))
+	})
+
+	var got []string
+	_, err := NewTransactionSyncer(client, NewMemoryCheckpointStore(), nil).Sync(context.Background(), func(_ context.Context, tx *Transaction, _ TransactionStatus) error {
+		got = append(got, tx.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TransactionSyncer.Sync returned error: %v", err)
+	}
+
+	// The oldest transaction of the first page is listed again on the second.
+	var want []string
+	for i := 0; i < 150; i++ {
+		want = append(want, fmt.Sprintf("%03d", i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TransactionSyncer.Sync handled %v, want %v", got, want)
+	}
+}
@@ -14,37 +14,106 @@ type TransactionService struct {
 	client *Client
 }
 
+// TransactionStatus is the status of the transaction.
+type TransactionStatus string
+
 // Transaction statuses.
 const (
-	TransactionStatusCreated            = "Created"
-	TransactionStatusCanceled           = "Canceled"
-	TransactionStatusProcessing         = "Processing"
-	TransactionStatusProcessed          = "Processed"
-	TransactionStatusPartiallyProcessed = "PartiallyProcessed"
+	TransactionStatusCreated            TransactionStatus = "Created"
+	TransactionStatusCanceled           TransactionStatus = "Canceled"
+	TransactionStatusProcessing         TransactionStatus = "Processing"
+	TransactionStatusProcessed          TransactionStatus = "Processed"
+	TransactionStatusPartiallyProcessed TransactionStatus = "PartiallyProcessed"
 )
 
+// transactionTransitions lists the statuses the transaction can move to from
+// the non-terminal statuses.
+var transactionTransitions = map[TransactionStatus][]TransactionStatus{
+	TransactionStatusCreated: {
+		TransactionStatusProcessing, TransactionStatusProcessed,
+		TransactionStatusPartiallyProcessed, TransactionStatusCanceled,
+	},
+	TransactionStatusProcessing: {
+		TransactionStatusProcessed, TransactionStatusPartiallyProcessed, TransactionStatusCanceled,
+	},
+}
+
+// IsTerminal reports whether the transaction can no longer change its status.
+func (s TransactionStatus) IsTerminal() bool {
+	switch s {
+	case TransactionStatusCanceled,
+		TransactionStatusProcessed,
+		TransactionStatusPartiallyProcessed:
+		return true
+	}
+
+	return false
+}
+
+// IsSuccessful reports whether the transaction is processed, fully or partially.
+func (s TransactionStatus) IsSuccessful() bool {
+	return s == TransactionStatusProcessed || s == TransactionStatusPartiallyProcessed
+}
+
+// CanTransitionTo reports whether the transaction can move from the status to next.
+// Staying in the same status is always possible. Transitions involving
+// statuses unknown to the library are allowed.
+func (s TransactionStatus) CanTransitionTo(next TransactionStatus) bool {
+	if s == next || !s.known() || !next.known() {
+		return true
+	}
+	for _, status := range transactionTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// known reports whether the status is known to the library.
+func (s TransactionStatus) known() bool {
+	_, ok := transactionTransitions[s]
+	return ok || s.IsTerminal()
+}
+
+// TransactionType is the type of the transaction.
+type TransactionType string
+
 // Transaction types.
 const (
-	TransactionTypeDeposit  = "Deposit"
-	TransactionTypeWithdraw = "Withdraw"
-	TransactionTypeRefund   = "Refund"
+	TransactionTypeDeposit  TransactionType = "Deposit"
+	TransactionTypeWithdraw TransactionType = "Withdraw"
+	TransactionTypeRefund   TransactionType = "Refund"
 )
 
 // Transaction represents a KunaPay transaction.
 type Transaction struct {
-	ID              string `json:"id"`
-	Address         string `json:"address"`
-	Amount          string `json:"amount"`
-	Asset           string `json:"asset"`
-	Fee             string `json:"fee"`
-	ProcessedAmount string `json:"processedAmount"`
-	Status          string `json:"status"`
-	PaymentCode     string `json:"paymentCode"`
-	Type            string `json:"type"`
-	CreatedAt       string `json:"createdAt"`
-	InvoiceID       string `json:"invoiceId,omitempty"`
+	ID              string            `json:"id"`
+	Address         string            `json:"address"`
+	Amount          string            `json:"amount"`
+	Asset           string            `json:"asset"`
+	Fee             string            `json:"fee"`
+	ProcessedAmount string            `json:"processedAmount"`
+	Status          TransactionStatus `json:"status"`
+	PaymentCode     string            `json:"paymentCode"`
+	Type            TransactionType   `json:"type"`
+	CreatedAt       string            `json:"createdAt"`
+	InvoiceID       string            `json:"invoiceId,omitempty"`
+
+	// Expanded is the invoice of the transaction, set only when the
+	// transaction is listed or got with the Expand option. It is left out
+	// of the JSON encoding, which stays the one of the API.
+	Expanded *TransactionInvoice `json:"-"`
 }
 
+// TransactionOrderBy is the field the transactions are ordered by.
+type TransactionOrderBy string
+
+const (
+	TransactionOrderByCreatedAt TransactionOrderBy = "createdAt"
+)
+
 // TransactionListOpts specifies the optional parameters to the
 // TransactionService.List method.
 type TransactionListOpts struct {
@@ -53,7 +122,17 @@ type TransactionListOpts struct {
 	Asset       string
 	CreatedFrom *time.Time
 	CreatedTo   *time.Time
-	OrderBy     string
+	OrderBy     TransactionOrderBy
+
+	// Types and Statuses limit the transactions to the ones of any of the
+	// types and statuses. The API does not filter by them, so they are
+	// applied to the listed pages client-side, and Take and Skip count
+	// the matching transactions only.
+	Types    []TransactionType
+	Statuses []TransactionStatus
+
+	// Expand joins the listed transactions with their invoices.
+	Expand bool
 }
 
 // values converts TransactionListOpts to url.Values to be used in query string.
@@ -75,16 +154,110 @@ func (o *TransactionListOpts) values() url.Values {
 		v.Add("createdTo", o.CreatedTo.Format(time.RFC3339))
 	}
 	if o.OrderBy != "" {
-		v.Add("orderBy", o.OrderBy)
+		v.Add("orderBy", string(o.OrderBy))
 	}
 
 	return v
 }
 
+// filtered reports whether the options have filters applied client-side.
+func (o *TransactionListOpts) filtered() bool {
+	return len(o.Types) > 0 || len(o.Statuses) > 0
+}
+
+// matches reports whether the transaction passes the client-side filters.
+func (o *TransactionListOpts) matches(tx *Transaction) bool {
+	if len(o.Types) > 0 {
+		var ok bool
+		for _, t := range o.Types {
+			ok = ok || t == tx.Type
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(o.Statuses) > 0 {
+		var ok bool
+		for _, status := range o.Statuses {
+			ok = ok || status == tx.Status
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
 // List returns information on all invoices and withdrawal operations.
 //
+// When the options filter by type or status, List pages through the
+// transactions from the start until it has Take matching ones, 100 by
+// default, and returns the response of the last page.
+//
+// With the Expand option, the invoices of the transactions are fetched
+// concurrently, each of them once, and set in their Expanded fields.
+//
 // API docs: https://docs-pay.kuna.io/reference/transactioncontroller_gettransactions
 func (s *TransactionService) List(ctx context.Context, opts *TransactionListOpts) ([]*Transaction, *Response, error) {
+	list := s.list
+	if opts != nil && opts.filtered() {
+		list = s.listFiltered
+	}
+
+	txs, resp, err := list(ctx, opts)
+	if err != nil {
+		return nil, resp, err
+	}
+	if opts != nil && opts.Expand {
+		if err := s.expand(ctx, txs); err != nil {
+			return nil, resp, err
+		}
+	}
+
+	return txs, resp, nil
+}
+
+// listFiltered lists the transactions matching the client-side filters.
+func (s *TransactionService) listFiltered(ctx context.Context, opts *TransactionListOpts) ([]*Transaction, *Response, error) {
+	page := *opts
+	page.Types, page.Statuses = nil, nil
+	page.Take, page.Skip = invoiceListPageSize, 0
+
+	take := opts.Take
+	if take <= 0 {
+		take = invoiceListPageSize
+	}
+	skip := opts.Skip
+
+	result := []*Transaction{}
+	for {
+		txs, resp, err := s.list(ctx, &page)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, tx := range txs {
+			if !opts.matches(tx) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			result = append(result, tx)
+			if int64(len(result)) == take {
+				return result, resp, nil
+			}
+		}
+		if int64(len(txs)) < page.Take {
+			return result, resp, nil
+		}
+		page.Skip += page.Take
+	}
+}
+
+// list sends a single List request.
+func (s *TransactionService) list(ctx context.Context, opts *TransactionListOpts) ([]*Transaction, *Response, error) {
 	u := "transaction"
 	if opts != nil {
 		u += "?" + opts.values().Encode()
@@ -107,11 +280,20 @@ func (s *TransactionService) List(ctx context.Context, opts *TransactionListOpts
 	return root.Data, resp, err
 }
 
+// TransactionGetOpts specifies the optional parameters to the
+// TransactionService.Get method.
+type TransactionGetOpts struct {
+	// Expand joins the transaction with its invoice.
+	Expand bool
+}
+
 // Get returns detailed information on a single transaction.
 // The transaction identifier is passed in the id parameter.
+// With the Expand option, the invoice of the transaction is set in its
+// Expanded field.
 //
 // API docs: https://docs-pay.kuna.io/reference/transactioncontroller_gettransactionbyid
-func (s *TransactionService) Get(ctx context.Context, id string) (*Transaction, *Response, error) {
+func (s *TransactionService) Get(ctx context.Context, id string, opts ...*TransactionGetOpts) (*Transaction, *Response, error) {
 	if strings.TrimSpace(id) == "" {
 		return nil, nil, fmt.Errorf("transaction ID is required")
 	}
@@ -128,6 +310,14 @@ func (s *TransactionService) Get(ctx context.Context, id string) (*Transaction,
 	if err != nil {
 		return nil, resp, err
 	}
+	for _, o := range opts {
+		if o != nil && o.Expand && root.Data != nil {
+			if err := s.expand(ctx, []*Transaction{root.Data}); err != nil {
+				return nil, resp, err
+			}
+			break
+		}
+	}
 
 	return root.Data, resp, err
 }
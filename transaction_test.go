@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -146,3 +148,63 @@ func transactionMock() *Transaction {
 		CreatedAt:       "2023-07-30T00:00:00.000Z",
 	}
 }
+
+func TestTransactionService_ListFiltered(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	var requests []string
+	mux.HandleFunc("/v1/transaction", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		requests = append(requests, r.RequestURI)
+
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		var txs []string
+		for i := skip; i < skip+invoiceListPageSize && i < 250; i++ {
+			typ, status := TransactionTypeDeposit, TransactionStatusProcessed
+			if i%2 == 1 {
+				typ = TransactionTypeWithdraw
+			}
+			if i%5 == 0 {
+				status = TransactionStatusCanceled
+			}
+			txs = append(txs, fmt.Sprintf(`{"id":"%d","type":%q,"status":%q}`, i, typ, status))
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(txs, ","))
+	})
+
+	opts := &TransactionListOpts{
+		Take:     60,
+		Skip:     10,
+		Asset:    "USDT",
+		Types:    []TransactionType{TransactionTypeDeposit},
+		Statuses: []TransactionStatus{TransactionStatusProcessed, TransactionStatusPartiallyProcessed},
+	}
+	transactions, _, err := client.Transaction.List(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Transaction.List returned error: %v", err)
+	}
+
+	// Processed deposits are the even IDs not divisible by 10: 2, 4, 6, 8, 12, ...
+	var ids []string
+	for _, tx := range transactions {
+		ids = append(ids, tx.ID)
+	}
+	if len(ids) != 60 || ids[0] != "26" || ids[59] != "174" {
+		t.Errorf("Transaction.List returned %v", ids)
+	}
+	want := []string{
+		"/v1/transaction?asset=USDT&take=100",
+		"/v1/transaction?asset=USDT&skip=100&take=100",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Transaction.List requested %v, want %v", requests, want)
+	}
+
+	requests = nil
+	opts = &TransactionListOpts{Types: []TransactionType{TransactionTypeRefund}}
+	transactions, _, err = client.Transaction.List(context.Background(), opts)
+	if err != nil || len(transactions) != 0 || len(requests) != 3 {
+		t.Errorf("Transaction.List returned %v, %v after %d requests, want none after 3", transactions, err, len(requests))
+	}
+}
@@ -0,0 +1,388 @@
+package kunapay
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WatcherOpts specifies the optional parameters to the Watcher.
+type WatcherOpts struct {
+	// Workers is the number of concurrent polls. Defaults to 8.
+	Workers int
+
+	// MinInterval is the delay between the polls of an invoice that has just
+	// changed or is about to expire. Defaults to 5 seconds.
+	MinInterval time.Duration
+
+	// MaxInterval is the maximum delay between the polls of an idle invoice.
+	// Defaults to 2 minutes.
+	MaxInterval time.Duration
+
+	// NearExpiry is the period before the invoice expiration time during which
+	// the invoice is polled with the MinInterval. Defaults to 5 minutes.
+	NearExpiry time.Duration
+
+	// Buffer is the capacity of the events channel. Defaults to 64.
+	Buffer int
+
+	// OnError is called when an invoice cannot be polled. The invoice is
+	// polled again later.
+	OnError func(id string, err error)
+}
+
+// Watcher polls the tracked invoices with a bounded pool of workers and emits
+// the status changes on the events channel.
+//
+// An idle invoice is polled less often over time, and an invoice close to
+// its expiration time or that has just changed is polled more often.
+// Invoices are dropped once they reach a terminal status.
+type Watcher struct {
+	client *Client
+	opts   WatcherOpts
+	events chan *InvoiceEvent
+
+	mu       sync.Mutex
+	queue    watchQueue
+	invoices map[string]*watchedInvoice
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	cancel  context.CancelFunc
+	started sync.Once
+	stopped sync.Once
+
+	now func() time.Time
+}
+
+// watchedInvoice is the state of an invoice tracked by the Watcher.
+type watchedInvoice struct {
+	id       string
+	status   InvoiceStatus
+	expireAt time.Time
+	interval time.Duration
+	next     time.Time
+
+	// index in the queue, -1 while the invoice is being polled.
+	index int
+}
+
+// NewWatcher returns a new Watcher. Call Start to begin polling.
+func NewWatcher(client *Client, opts *WatcherOpts) *Watcher {
+	o := WatcherOpts{
+		Workers:     8,
+		MinInterval: 5 * time.Second,
+		MaxInterval: 2 * time.Minute,
+		NearExpiry:  5 * time.Minute,
+		Buffer:      64,
+	}
+	if opts != nil {
+		if opts.Workers > 0 {
+			o.Workers = opts.Workers
+		}
+		if opts.MinInterval > 0 {
+			o.MinInterval = opts.MinInterval
+		}
+		if opts.MaxInterval > 0 {
+			o.MaxInterval = opts.MaxInterval
+		}
+		if opts.NearExpiry > 0 {
+			o.NearExpiry = opts.NearExpiry
+		}
+		if opts.Buffer > 0 {
+			o.Buffer = opts.Buffer
+		}
+		o.OnError = opts.OnError
+	}
+	if o.MaxInterval < o.MinInterval {
+		o.MaxInterval = o.MinInterval
+	}
+
+	return &Watcher{
+		client:   client,
+		opts:     o,
+		events:   make(chan *InvoiceEvent, o.Buffer),
+		invoices: make(map[string]*watchedInvoice),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		cancel:   func() {},
+		now:      time.Now,
+	}
+}
+
+// Events returns the channel of the invoice status changes.
+// The channel is closed after the watcher stops.
+func (w *Watcher) Events() <-chan *InvoiceEvent {
+	return w.events
+}
+
+// Add starts watching the invoice with the last known status, which may be empty.
+// The invoice is polled as soon as a worker is free.
+// Invoices in a terminal status are ignored.
+func (w *Watcher) Add(id string, status InvoiceStatus) {
+	if status.IsTerminal() {
+		return
+	}
+
+	w.mu.Lock()
+	if _, ok := w.invoices[id]; ok {
+		w.mu.Unlock()
+		return
+	}
+	inv := &watchedInvoice{
+		id:       id,
+		status:   status,
+		interval: w.opts.MinInterval,
+		next:     w.now(),
+	}
+	w.invoices[id] = inv
+	heap.Push(&w.queue, inv)
+	w.mu.Unlock()
+
+	w.notify()
+}
+
+// Remove stops watching the invoice.
+func (w *Watcher) Remove(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	inv, ok := w.invoices[id]
+	if !ok {
+		return
+	}
+	delete(w.invoices, id)
+	if inv.index >= 0 {
+		heap.Remove(&w.queue, inv.index)
+	}
+}
+
+// Len returns the number of watched invoices.
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.invoices)
+}
+
+// Start starts the workers. The watcher stops when Stop is called
+// or the context is canceled. Start can be called only once.
+func (w *Watcher) Start(ctx context.Context) {
+	w.started.Do(func() {
+		ctx, w.cancel = context.WithCancel(ctx)
+		jobs := make(chan *watchedInvoice)
+
+		var wg sync.WaitGroup
+		wg.Add(w.opts.Workers)
+		for i := 0; i < w.opts.Workers; i++ {
+			go func() {
+				defer wg.Done()
+				for inv := range jobs {
+					w.poll(ctx, inv)
+				}
+			}()
+		}
+
+		go func() {
+			w.schedule(ctx, jobs)
+			close(jobs)
+			wg.Wait()
+			close(w.events)
+			close(w.done)
+		}()
+	})
+}
+
+// Stop stops polling and waits for the polls in progress to finish and
+// deliver their events, then closes the events channel. Events must be
+// received until the channel is closed. If the context is done first,
+// the polls in progress are canceled.
+func (w *Watcher) Stop(ctx context.Context) error {
+	w.stopped.Do(func() { close(w.stop) })
+
+	// A watcher that was never started has nothing to drain.
+	w.started.Do(func() {
+		close(w.events)
+		close(w.done)
+	})
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		return ctx.Err()
+	}
+}
+
+// schedule sends the invoices that are due to the workers.
+func (w *Watcher) schedule(ctx context.Context, jobs chan<- *watchedInvoice) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		w.mu.Lock()
+		var (
+			due  *watchedInvoice
+			wait = time.Hour
+		)
+		if w.queue.Len() > 0 {
+			if d := w.queue[0].next.Sub(w.now()); d <= 0 {
+				due = heap.Pop(&w.queue).(*watchedInvoice)
+			} else {
+				wait = d
+			}
+		}
+		w.mu.Unlock()
+
+		if due != nil {
+			select {
+			case jobs <- due:
+				continue
+			case <-w.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+		case <-w.wake:
+		case <-w.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll fetches the invoice, emits the status change and schedules the next poll.
+// The invoice is queued again only after its event is delivered, so the events
+// of an invoice are emitted in order.
+func (w *Watcher) poll(ctx context.Context, inv *watchedInvoice) {
+	detail, _, err := w.client.Invoice.Get(ctx, inv.id)
+	if err == nil && detail == nil {
+		err = fmt.Errorf("invoice %s: empty response", inv.id)
+	}
+
+	w.mu.Lock()
+	if cur, ok := w.invoices[inv.id]; !ok || cur != inv {
+		w.mu.Unlock()
+		return
+	}
+
+	var event *InvoiceEvent
+	if err == nil {
+		if t, perr := parseTime(detail.ExpireAt); perr == nil {
+			inv.expireAt = t
+		}
+		if detail.Status != inv.status {
+			event = &InvoiceEvent{
+				InvoiceID:      inv.id,
+				PreviousStatus: inv.status,
+				Status:         detail.Status,
+				Source:         InvoiceEventSourcePoll,
+				OccurredAt:     w.now(),
+				Invoice:        detail,
+			}
+			inv.status = detail.Status
+		}
+	}
+	if inv.status.IsTerminal() {
+		delete(w.invoices, inv.id)
+	}
+	w.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil && w.opts.OnError != nil {
+		w.opts.OnError(inv.id, err)
+	}
+	if event != nil {
+		select {
+		case w.events <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	w.mu.Lock()
+	if cur, ok := w.invoices[inv.id]; ok && cur == inv {
+		w.reschedule(inv, event != nil)
+		heap.Push(&w.queue, inv)
+	}
+	w.mu.Unlock()
+
+	w.notify()
+}
+
+// reschedule calculates the time of the next poll of the invoice.
+func (w *Watcher) reschedule(inv *watchedInvoice, changed bool) {
+	now := w.now()
+
+	if changed {
+		inv.interval = w.opts.MinInterval
+	} else if inv.interval *= 2; inv.interval > w.opts.MaxInterval {
+		inv.interval = w.opts.MaxInterval
+	}
+
+	if !inv.expireAt.IsZero() {
+		untilExpiry := inv.expireAt.Sub(now)
+		if untilExpiry <= w.opts.NearExpiry {
+			inv.interval = w.opts.MinInterval
+		} else if inv.interval > untilExpiry-w.opts.NearExpiry {
+			// Wake up right when the invoice gets close to the expiration.
+			inv.interval = untilExpiry - w.opts.NearExpiry
+		}
+	}
+
+	inv.next = now.Add(inv.interval)
+}
+
+// notify wakes up the scheduler.
+func (w *Watcher) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// watchQueue is a priority queue of the invoices ordered by the next poll time.
+type watchQueue []*watchedInvoice
+
+func (q watchQueue) Len() int           { return len(q) }
+func (q watchQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q watchQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *watchQueue) Push(x any) {
+	inv := x.(*watchedInvoice)
+	inv.index = len(*q)
+	*q = append(*q, inv)
+}
+
+func (q *watchQueue) Pop() any {
+	old := *q
+	n := len(old)
+	inv := old[n-1]
+	old[n-1] = nil
+	inv.index = -1
+	*q = old[:n-1]
+
+	return inv
+}
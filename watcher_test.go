@@ -0,0 +1,144 @@
+package kunapay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	statuses := map[string][]InvoiceStatus{
+		"first":  {InvoiceStatusPaymentAwaiting, InvoiceStatusPaymentAwaiting, InvoiceStatusPaid},
+		"second": {InvoiceStatusPaymentAwaiting, InvoiceStatusTimeout},
+	}
+	var mu sync.Mutex
+	polls := make(map[string]int)
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/invoice/")
+
+		mu.Lock()
+		n := polls[id]
+		if n < len(statuses[id])-1 {
+			polls[id]++
+		}
+		status := statuses[id][n]
+		mu.Unlock()
+
+		fmt.Fprintf(w, `{"data":{"id":%q,"status":%q,"expireAt":"2099-01-01T00:00:00.000Z"}}`, id, status)
+	})
+
+	w := NewWatcher(client, &WatcherOpts{Workers: 2, MinInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond})
+	w.Add("first", InvoiceStatusCreated)
+	w.Add("second", "")
+	w.Add("terminal", InvoiceStatusPaid)
+	w.Start(context.Background())
+
+	got := make(map[string][]string)
+	for e := range w.Events() {
+		got[e.InvoiceID] = append(got[e.InvoiceID], string(e.PreviousStatus)+"->"+string(e.Status))
+		if len(got["first"]) == 2 && len(got["second"]) == 2 {
+			if err := w.Stop(context.Background()); err != nil {
+				t.Errorf("Watcher.Stop returned error: %v", err)
+			}
+		}
+	}
+
+	want := map[string][]string{
+		"first":  {"CREATED->PAYMENT_AWAITING", "PAYMENT_AWAITING->PAID"},
+		"second": {"->PAYMENT_AWAITING", "PAYMENT_AWAITING->TIMEOUT"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Watcher emitted %v, want %v", got, want)
+	}
+	if n := w.Len(); n != 0 {
+		t.Errorf("Watcher.Len returned %d, want 0", n)
+	}
+}
+
+func TestWatcher_emptyResponse(t *testing.T) {
+	client, mux, teardown := setupClient()
+	defer teardown()
+
+	mux.HandleFunc("/v1/invoice/empty", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":null}`)
+	})
+
+	errs := make(chan error, 1)
+	w := NewWatcher(client, &WatcherOpts{
+		MinInterval: time.Hour,
+		OnError: func(id string, err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	w.Add("empty", InvoiceStatusCreated)
+	w.Start(context.Background())
+	defer w.Stop(context.Background())
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "invoice empty: empty response") {
+			t.Errorf("Watcher reported error %v, want empty response", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Watcher did not report the empty response")
+	}
+	if n := w.Len(); n != 1 {
+		t.Errorf("Watcher.Len returned %d, want 1", n)
+	}
+}
+
+func TestWatcher_StopWithoutStart(t *testing.T) {
+	client, _, teardown := setupClient()
+	defer teardown()
+
+	w := NewWatcher(client, nil)
+	w.Add("invoice", InvoiceStatusCreated)
+	w.Remove("invoice")
+	if err := w.Stop(context.Background()); err != nil {
+		t.Errorf("Watcher.Stop returned error: %v", err)
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Errorf("Watcher events channel is open after Stop")
+	}
+}
+
+func TestWatcher_reschedule(t *testing.T) {
+	now := time.Date(2023, 7, 30, 0, 0, 0, 0, time.UTC)
+	w := NewWatcher(nil, &WatcherOpts{MinInterval: time.Second, MaxInterval: time.Minute, NearExpiry: 5 * time.Minute})
+	w.now = func() time.Time { return now }
+
+	tests := []struct {
+		title    string
+		interval time.Duration
+		expireAt time.Time
+		changed  bool
+		want     time.Duration
+	}{
+		{"idle invoice backs off", 10 * time.Second, time.Time{}, false, 20 * time.Second},
+		{"idle invoice is capped", 40 * time.Second, time.Time{}, false, time.Minute},
+		{"changed invoice is polled fast", 40 * time.Second, time.Time{}, true, time.Second},
+		{"invoice near expiry is polled fast", 40 * time.Second, now.Add(time.Minute), false, time.Second},
+		{"idle invoice wakes up before expiry", 40 * time.Second, now.Add(6 * time.Minute), false, time.Minute},
+		{"poll right when expiry gets close", 40 * time.Second, now.Add(5*time.Minute + 10*time.Second), false, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			inv := &watchedInvoice{interval: test.interval, expireAt: test.expireAt}
+			w.reschedule(inv, test.changed)
+			if got := inv.next.Sub(now); got != test.want {
+				t.Errorf("Watcher.reschedule next poll in %v, want %v", got, test.want)
+			}
+		})
+	}
+}